@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// maxMessageLength is the longest messageText accepted by the Nomi API.
+const maxMessageLength = 600
+
+// statusError reports a non-200 response from the Nomi API.
+type statusError struct {
+	Status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("Error: %s", e.Status)
+}
+
+// apiGet performs an authenticated GET on path (relative to baseURL) and
+// decodes the JSON response into v.
+func apiGet(path string, v interface{}) error {
+	client := newHTTPClient()
+	req, err := http.NewRequest("GET", baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{Status: resp.Status}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
+
+// fetchNomis retrieves every Nomi visible to the API key.
+func fetchNomis() ([]Nomi, error) {
+	var result NomiResponse
+	if err := apiGet("/nomis", &result); err != nil {
+		return nil, err
+	}
+	return result.Nomis, nil
+}
+
+// fetchNomi retrieves a single Nomi by its UUID.
+func fetchNomi(id string) (Nomi, error) {
+	var nomi Nomi
+	err := apiGet("/nomis/"+id, &nomi)
+	return nomi, err
+}
+
+// fetchRooms retrieves every room visible to the API key.
+func fetchRooms() ([]Room, error) {
+	var result RoomResponse
+	if err := apiGet("/rooms", &result); err != nil {
+		return nil, err
+	}
+	return result.Rooms, nil
+}
+
+// sendChat posts a message to a Nomi and returns the API's reply. It is the
+// single send path shared by every command that talks to a Nomi: it runs
+// the configured message hooks and notifies the webhooks of each reply.
+// A config that can't be loaded stops the message, as its send hooks may be
+// there to veto or redact it; a failing reply hook only causes a warning on
+// stderr, and the reply is kept as the API returned it.
+func sendChat(nomi Nomi, text string) (ChatResponse, error) {
+	var chatResponse ChatResponse
+
+	// Let send hooks rewrite or veto the message
+	config, err := loadConfig()
+	if err != nil {
+		return chatResponse, fmt.Errorf("error loading config: %v", err)
+	}
+	text, err = runHooks(config.Hooks, hookSend, nomi, text)
+	if err != nil {
+		return chatResponse, err
+	}
+
+	requestBody, err := json.Marshal(ChatRequest{MessageText: text})
+	if err != nil {
+		return chatResponse, fmt.Errorf("error encoding request body: %v", err)
+	}
+
+	client := newHTTPClient()
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/nomis/%s/chat", baseURL, nomi.UUID), bytes.NewBuffer(requestBody))
+	if err != nil {
+		return chatResponse, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return chatResponse, fmt.Errorf("error sending message: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return chatResponse, &statusError{Status: resp.Status}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&chatResponse); err != nil {
+		return chatResponse, fmt.Errorf("error decoding response: %v", err)
+	}
+	latency := time.Since(start)
+
+	// Let reply hooks rewrite the reply before anyone sees it
+	if reply, err := runHooks(config.Hooks, hookReply, nomi, chatResponse.ReplyMessage.Text); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v, showing the reply unchanged\n", err)
+	} else {
+		chatResponse.ReplyMessage.Text = reply
+	}
+
+	notifyWebhooks(nomi, chatResponse, latency)
+	return chatResponse, nil
+}
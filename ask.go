@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// askColumnGap separates the columns of side-by-side replies.
+const askColumnGap = " │ "
+
+// askMinColumn is the narrowest column side-by-side replies are shown in;
+// below it, replies are stacked.
+const askMinColumn = 24
+
+// askResult is the outcome of asking one Nomi.
+type askResult struct {
+	Query     string   `json:"query"`
+	Nomi      *Nomi    `json:"nomi,omitempty"`
+	Reply     *Message `json:"reply,omitempty"`
+	LatencyMs int64    `json:"latencyMs,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// askNomis sends text to each Nomi concurrently. Queries are matched against
+// nomis, so that the list is fetched once for all of them. Each Nomi is sent
+// to on its own, so one failing doesn't affect the others. Results are in the
+// order of the queries.
+func askNomis(nomis []Nomi, queries []string, text string) []askResult {
+	results := make([]askResult, len(queries))
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		result := askResult{Query: query}
+		nomi, err := matchNomi(nomis, strings.TrimSpace(query))
+		if err != nil {
+			result.Error = err.Error()
+			results[i] = result
+			continue
+		}
+		result.Nomi = &nomi
+
+		wg.Add(1)
+		go func(i int, result askResult) {
+			defer wg.Done()
+			defer func() { results[i] = result }()
+
+			channel := newNomiChannel(*result.Nomi)
+			defer channel.Close()
+
+			start := time.Now()
+			chatResponse, err := channel.Send(text)
+			result.LatencyMs = time.Since(start).Milliseconds()
+			if err != nil {
+				result.Error = err.Error()
+				return
+			}
+			result.Reply = &chatResponse.ReplyMessage
+		}(i, result)
+	}
+	wg.Wait()
+	return results
+}
+
+// name returns the Nomi's name, or the query if it could not be resolved.
+func (r askResult) name() string {
+	if r.Nomi != nil {
+		return r.Nomi.Name
+	}
+	return r.Query
+}
+
+// header returns the title of a result: the name and latency.
+func (r askResult) header() string {
+	if r.Nomi == nil || r.LatencyMs == 0 {
+		return r.name()
+	}
+	return fmt.Sprintf("%s (%s)", r.name(), formatLatency(time.Duration(r.LatencyMs)*time.Millisecond))
+}
+
+// askColors returns the color of each result's Nomi.
+func askColors(results []askResult) map[string]string {
+	var nomis []Nomi
+	for _, r := range results {
+		if r.Nomi != nil {
+			nomis = append(nomis, *r.Nomi)
+		}
+	}
+	return theme.nomiColors(nomis)
+}
+
+// renderColumns lays out the replies side by side in columns filling width.
+// It returns "" when the terminal is too narrow for the columns.
+func renderColumns(results []askResult, width int) string {
+	column := (width - (len(results)-1)*displayWidth(askColumnGap)) / len(results)
+	if column < askMinColumn {
+		return ""
+	}
+	colors := askColors(results)
+
+	// Each cell is a list of lines, styled, with their plain width
+	type line struct {
+		text  string
+		width int
+	}
+	cells := make([][]line, len(results))
+	for i, r := range results {
+		header := strings.TrimRight(fit(r.header(), column), " ")
+		style := theme.Nomi
+		if r.Nomi != nil {
+			style = colors[r.Nomi.UUID]
+		}
+		cells[i] = append(cells[i],
+			line{paint(style, header), displayWidth(header)},
+			line{paint(theme.Dim, strings.Repeat("─", column)), column})
+
+		if r.Error != "" {
+			for _, text := range wrapText(r.Error, column) {
+				cells[i] = append(cells[i], line{paint(theme.Error, text), displayWidth(text)})
+			}
+			continue
+		}
+		for _, paragraph := range strings.Split(r.Reply.Text, "\n") {
+			bullet, content := listItem(paragraph)
+			bulletIndent := strings.Repeat(" ", displayWidth(bullet))
+			for j, words := range wrapWords(parseInline(content), column-len(bulletIndent)) {
+				prefix := bulletIndent
+				if j == 0 {
+					prefix = bullet
+				}
+				plain := prefix + formatLine(words, false)
+				cells[i] = append(cells[i], line{prefix + formatLine(words, true), displayWidth(plain)})
+			}
+		}
+	}
+
+	rows := 0
+	for _, cell := range cells {
+		if len(cell) > rows {
+			rows = len(cell)
+		}
+	}
+
+	var b strings.Builder
+	for row := 0; row < rows; row++ {
+		var parts []string
+		for _, cell := range cells {
+			var l line
+			if row < len(cell) {
+				l = cell[row]
+			}
+			parts = append(parts, l.text+strings.Repeat(" ", column-l.width))
+		}
+		b.WriteString(strings.TrimRight(strings.Join(parts, paint(theme.Dim, askColumnGap)), " ") + "\n")
+	}
+	return b.String()
+}
+
+// renderStacked shows the replies one after the other.
+func renderStacked(results []askResult, width int) string {
+	colors := askColors(results)
+	var b strings.Builder
+	for i, r := range results {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if r.Error != "" {
+			b.WriteString(fmt.Sprintf("%s: %s\n", paint(theme.Nomi, r.name()), paint(theme.Error, r.Error)))
+			continue
+		}
+		meta := fmt.Sprintf("[%s] ", formatLatency(time.Duration(r.LatencyMs)*time.Millisecond))
+		b.WriteString(renderReply(meta, r.Nomi.Name, colors[r.Nomi.UUID], r.Reply.Text, width))
+	}
+	return b.String()
+}
+
+var askNomiQueries []string
+var askAll bool
+var askJSON bool
+var askStack bool
+
+var askCmd = &cobra.Command{
+	Use:   "ask [message]",
+	Short: "Send a message to several Nomis and compare their replies",
+	Long: `Send a message to several Nomis and compare their replies.
+
+The message goes to every Nomi given with --nomi, or to all your Nomis with
+--all, at the same time. Replies are shown side by side with how long each
+took, or stacked when the terminal is too narrow (or with --stack). A Nomi
+that can't be found or fails to reply shows an error without affecting the
+others. Use --json for machine-readable output.
+
+The message is taken from the arguments, or read from stdin when none are
+given.`,
+	Example: `  nomi-cli ask --nomi Alice --nomi Bob "What should I cook tonight?"
+  nomi-cli ask --all --json "Describe yourself in one sentence" | jq .`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(askNomiQueries) == 0 && !askAll {
+			fmt.Println("Error: choose Nomis with --nomi or --all")
+			return
+		}
+
+		message, err := readMessage(args)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		nomis, err := fetchNomis()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		queries := askNomiQueries
+		if askAll {
+			for _, nomi := range nomis {
+				queries = append(queries, nomi.UUID)
+			}
+		}
+		queries = uniqueStrings(queries)
+		if len(queries) == 0 {
+			fmt.Println("You have no Nomis to ask.")
+			return
+		}
+
+		results := askNomis(nomis, queries, message)
+
+		if askJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(results)
+			return
+		}
+
+		width := outputWidth()
+		output := ""
+		if !askStack && len(results) > 1 {
+			output = renderColumns(results, width)
+		}
+		if output == "" {
+			output = renderStacked(results, width)
+		}
+		fmt.Print(output)
+	},
+}
+
+// uniqueStrings returns values without duplicates, in order.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+func init() {
+	askCmd.Flags().StringArrayVar(&askNomiQueries, "nomi", nil, "Nomi to ask, by UUID, UUID prefix or name (repeatable)")
+	askCmd.Flags().BoolVar(&askAll, "all", false, "Ask all your Nomis")
+	askCmd.Flags().BoolVar(&askJSON, "json", false, "Print the results as JSON")
+	askCmd.Flags().BoolVar(&askStack, "stack", false, "Show replies one after the other rather than side by side")
+}
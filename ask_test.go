@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestAskNomis(t *testing.T) {
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	nomis, err := fetchNomis()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	results := askNomis(nomis, []string{"Alice", "Nobody", "bob"}, "Hi all")
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[0].Nomi == nil || results[0].Nomi.Name != "Alice" || results[0].Reply.Text != "You said: Hi all" {
+		t.Errorf("Unexpected result for Alice: %+v", results[0])
+	}
+	if results[1].Error == "" || results[1].Nomi != nil {
+		t.Errorf("Expected an error for an unknown Nomi, got %+v", results[1])
+	}
+	if results[2].Nomi == nil || results[2].Nomi.Name != "Bob" || results[2].Error != "" {
+		t.Errorf("Expected Bob to reply despite the error, got %+v", results[2])
+	}
+}
+
+func TestRenderColumns(t *testing.T) {
+	results := []askResult{
+		{Query: "Alice", Nomi: &Nomi{UUID: "a", Name: "Alice"}, Reply: &Message{Text: "*thinks* Pasta with a lot of garlic"}, LatencyMs: 1200},
+		{Query: "Nobody", Error: "Error: no Nomi matches \"Nobody\""},
+	}
+
+	got := ansiPattern.ReplaceAllString(renderColumns(results, 60), "")
+	want := strings.Join([]string{
+		"Alice (1.2s)                 │ Nobody",
+		"──────────────────────────── │ ────────────────────────────",
+		"thinks Pasta with a lot of   │ Error: no Nomi matches",
+		"garlic                       │ \"Nobody\"",
+	}, "\n") + "\n"
+	if got != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	if renderColumns(append(results, results...), 60) != "" {
+		t.Error("Expected no columns when they would be too narrow")
+	}
+}
+
+func TestAskCmdJSON(t *testing.T) {
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	mock := newMockServer().handler()
+	var listed atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/nomis" {
+			listed.Add(1)
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+	defer func() { askNomiQueries, askAll, askJSON = nil, false, false }()
+
+	rootCmd := &cobra.Command{Use: "test"}
+	rootCmd.AddCommand(askCmd)
+	rootCmd.SetArgs([]string{"ask", "--all", "--json", "Who", "are", "you?"})
+	output := captureStdout(t, func() {
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	var results []askResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("Expected JSON output, got %q: %v", output, err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected a result per Nomi, got %+v", results)
+	}
+	if n := listed.Load(); n != 1 {
+		t.Errorf("Expected the Nomis to be listed once, got %d", n)
+	}
+	for _, r := range results {
+		if r.Reply == nil || r.Reply.Text != "You said: Who are you?" || r.Error != "" {
+			t.Errorf("Unexpected result %+v", r)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// attachMaxBytes is the largest file or output read as an attachment. Only
+// what fits in the message is sent, but reading is bounded too.
+const attachMaxBytes = 1 << 20
+
+// truncatedMarker ends an attachment cut to fit in the message.
+const truncatedMarker = "…[truncated]"
+
+// attachment is text inlined into a message: a file, command output or the
+// clipboard.
+type attachment struct {
+	Label   string // Like "file notes.txt" or "$ git log -5"
+	Content string
+}
+
+// textContent checks data is text that can be sent, trimming trailing
+// newlines.
+func textContent(data []byte, what string) (string, error) {
+	if len(data) > attachMaxBytes {
+		return "", fmt.Errorf("%s is larger than %d KiB", what, attachMaxBytes>>10)
+	}
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return "", fmt.Errorf("%s is not text", what)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// attachFile reads a file to attach.
+func attachFile(path string) (attachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return attachment{}, err
+	}
+	if info.IsDir() {
+		return attachment{}, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > attachMaxBytes {
+		return attachment{}, fmt.Errorf("%s is larger than %d KiB", path, attachMaxBytes>>10)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return attachment{}, err
+	}
+	content, err := textContent(data, path)
+	if err != nil {
+		return attachment{}, err
+	}
+	return attachment{Label: "file " + filepath.Base(path), Content: content}, nil
+}
+
+// attachCommand runs a shell command and attaches its output, stdout and
+// stderr together. A command failing is noted in the label, not an error.
+func attachCommand(line string) (attachment, error) {
+	line = strings.TrimSpace(line)
+	if len(line) >= 2 && (line[0] == '"' || line[0] == '\'') && line[len(line)-1] == line[0] {
+		line = line[1 : len(line)-1]
+	}
+	if line == "" {
+		return attachment{}, fmt.Errorf("no command given")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := shellCommand(ctx, line)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return attachment{}, fmt.Errorf("%q took longer than %s", line, hookTimeout)
+	}
+
+	label := "$ " + line
+	if _, exited := err.(*exec.ExitError); exited {
+		label += fmt.Sprintf(" (%v)", err)
+	} else if err != nil {
+		return attachment{}, err
+	}
+	content, err := textContent(output.Bytes(), "the output of "+line)
+	if err != nil {
+		return attachment{}, err
+	}
+	return attachment{Label: label, Content: content}, nil
+}
+
+// clipboardCommands are the commands reading the clipboard on each platform,
+// tried in order.
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbpaste"}}
+	case "windows":
+		return [][]string{{"powershell", "-NoProfile", "-Command", "Get-Clipboard"}}
+	}
+	return [][]string{
+		{"wl-paste", "--no-newline"},
+		{"xclip", "-selection", "clipboard", "-o"},
+		{"xsel", "--clipboard", "--output"},
+	}
+}
+
+// attachClipboard attaches the text in the clipboard.
+func attachClipboard() (attachment, error) {
+	for _, command := range clipboardCommands() {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stderr = &stderr
+		data, err := cmd.Output()
+		if err != nil {
+			if reason := strings.TrimSpace(stderr.String()); reason != "" {
+				err = fmt.Errorf("%v: %s", err, reason)
+			}
+			return attachment{}, fmt.Errorf("error reading the clipboard with %s: %v", command[0], err)
+		}
+		content, err := textContent(data, "the clipboard")
+		if err != nil {
+			return attachment{}, err
+		}
+		if content == "" {
+			return attachment{}, fmt.Errorf("the clipboard is empty")
+		}
+		return attachment{Label: "clipboard", Content: content}, nil
+	}
+	return attachment{}, fmt.Errorf("no clipboard tool found (tried %s)", clipboardToolNames())
+}
+
+// clipboardToolNames lists the clipboard commands of the platform.
+func clipboardToolNames() string {
+	var names []string
+	for _, command := range clipboardCommands() {
+		names = append(names, command[0])
+	}
+	return strings.Join(names, ", ")
+}
+
+// attachMessage inlines attachments after text, each under a "[label]"
+// header. Attachments are truncated to keep the message within the API's
+// length limit, or dropped when there is no room left; warnings say which.
+func attachMessage(text string, attachments []attachment) (string, []string) {
+	var warnings []string
+	message := text
+	for _, a := range attachments {
+		header := fmt.Sprintf("[%s]\n", a.Label)
+		if message != "" {
+			header = "\n\n" + header
+		}
+		room := maxMessageLength - utf8.RuneCountInString(message) - utf8.RuneCountInString(header)
+		length := utf8.RuneCountInString(a.Content)
+		if length <= room {
+			message += header + a.Content
+			continue
+		}
+
+		room -= utf8.RuneCountInString(truncatedMarker)
+		if room <= 0 {
+			warnings = append(warnings, fmt.Sprintf("%s left out: the message is already at the %d-character limit", a.Label, maxMessageLength))
+			continue
+		}
+		content := []rune(a.Content)[:room]
+		message += header + string(content) + truncatedMarker
+		warnings = append(warnings, fmt.Sprintf("%s truncated to %d of %d characters to fit the %d-character limit", a.Label, room, length, maxMessageLength))
+	}
+	return message, warnings
+}
+
+// attachDirective runs a chat attachment directive: /file <path>,
+// /run <command> or /clip.
+func attachDirective(directive, argument string) (attachment, error) {
+	switch directive {
+	case "/file":
+		if argument == "" {
+			return attachment{}, fmt.Errorf("usage: /file <path>")
+		}
+		return attachFile(argument)
+	case "/run":
+		return attachCommand(argument)
+	default:
+		return attachClipboard()
+	}
+}
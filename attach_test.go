@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestAttachFile(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notes, []byte("buy milk\ncall mum\n\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "image.png"), []byte{0x89, 'P', 'N', 'G', 0, 0xff}, 0600)
+
+	a, err := attachFile(notes)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if a.Label != "file notes.txt" || a.Content != "buy milk\ncall mum" {
+		t.Errorf("Unexpected attachment %+v", a)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "image.png"), dir, filepath.Join(dir, "missing.txt")} {
+		if _, err := attachFile(path); err == nil {
+			t.Errorf("Expected an error attaching %s", path)
+		}
+	}
+}
+
+func TestAttachCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands are sh commands in this test")
+	}
+
+	a, err := attachCommand(`"echo one; echo two >&2"`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if a.Label != "$ echo one; echo two >&2" || a.Content != "one\ntwo" {
+		t.Errorf("Unexpected attachment %+v", a)
+	}
+
+	a, err = attachCommand("echo failed; exit 2")
+	if err != nil || a.Label != "$ echo failed; exit 2 (exit status 2)" || a.Content != "failed" {
+		t.Errorf("Expected the output of a failing command, got %+v (%v)", a, err)
+	}
+}
+
+func TestAttachMessage(t *testing.T) {
+	message, warnings := attachMessage("Look:", []attachment{{Label: "file a.txt", Content: "short"}})
+	if message != "Look:\n\n[file a.txt]\nshort" || len(warnings) != 0 {
+		t.Errorf("Unexpected message %q, warnings %v", message, warnings)
+	}
+
+	long := strings.Repeat("x", maxMessageLength)
+	message, warnings = attachMessage("Look:", []attachment{{Label: "file big.txt", Content: long}, {Label: "clipboard", Content: "more"}})
+	if n := len([]rune(message)); n != maxMessageLength {
+		t.Errorf("Expected a message of %d characters, got %d", maxMessageLength, n)
+	}
+	if !strings.HasSuffix(message, "x"+truncatedMarker) {
+		t.Errorf("Expected the attachment to be marked as truncated, got %q", message[len(message)-30:])
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "file big.txt truncated to") || !strings.Contains(warnings[1], "clipboard left out") {
+		t.Errorf("Unexpected warnings %v", warnings)
+	}
+}
+
+func TestSendAttach(t *testing.T) {
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+	defer func() { sendAttachments = nil }()
+
+	notes := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(notes, []byte("buy milk\n"), 0600)
+
+	rootCmd := &cobra.Command{Use: "test"}
+	rootCmd.AddCommand(sendCmd)
+	rootCmd.SetArgs([]string{"send", "Alice", "--attach", notes, "Summarize"})
+	output := captureStdout(t, func() {
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want := "You said: Summarize\n\n[file notes.txt]\nbuy milk\n"; output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
+
+func TestSendAttachOnly(t *testing.T) {
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+	defer func() { sendAttachments = nil }()
+
+	notes := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(notes, []byte("buy milk\n"), 0600)
+
+	// Without a message, the attachment is sent on its own
+	rootCmd := &cobra.Command{Use: "test"}
+	rootCmd.AddCommand(sendCmd)
+	rootCmd.SetArgs([]string{"send", "Alice", "--attach", notes})
+	output := captureStdout(t, func() {
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want := "You said: [file notes.txt]\nbuy milk\n"; output != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
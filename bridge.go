@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+var bridgeCmd = &cobra.Command{
+	Use:   "bridge",
+	Short: "Connect a Nomi to other chat systems",
+}
+
+// rateLimiter allows each key a number of events per sliding window.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu     sync.Mutex
+	events map[string][]time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, events: make(map[string][]time.Time)}
+}
+
+// allow records an event for key and reports whether it is within the limit.
+// A limit of zero or less allows everything.
+func (r *rateLimiter) allow(key string, now time.Time) bool {
+	if r.limit <= 0 {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recent := r.events[key][:0]
+	for _, t := range r.events[key] {
+		if now.Sub(t) < r.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= r.limit {
+		r.events[key] = recent
+		return false
+	}
+	r.events[key] = append(recent, now)
+	return true
+}
+
+// splitLines breaks text into lines of at most max bytes, splitting on
+// newlines first and then on word boundaries. Words longer than max are cut
+// between runes.
+func splitLines(text string, max int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		paragraph = strings.TrimRight(paragraph, " \r\t")
+		if paragraph == "" {
+			continue
+		}
+		var line string
+		for _, word := range strings.Fields(paragraph) {
+			for len(word) > max {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				cut := max
+				for cut > 0 && !utf8.RuneStart(word[cut]) {
+					cut--
+				}
+				lines = append(lines, word[:cut])
+				word = word[cut:]
+			}
+			switch {
+			case line == "":
+				line = word
+			case len(line)+1+len(word) <= max:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func init() {
+	bridgeCmd.AddCommand(bridgeIRCCmd)
+	bridgeCmd.AddCommand(bridgeWebhookCmd)
+	bridgeCmd.AddCommand(bridgeSMTPCmd)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// ircMessage is a parsed IRC protocol line.
+type ircMessage struct {
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// Nick returns the nickname part of the message prefix.
+func (m ircMessage) Nick() string {
+	nick, _, _ := strings.Cut(m.Prefix, "!")
+	return nick
+}
+
+func parseIRCMessage(line string) ircMessage {
+	var m ircMessage
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, ":") {
+		m.Prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+	for line != "" {
+		if strings.HasPrefix(line, ":") {
+			m.Params = append(m.Params, line[1:])
+			break
+		}
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		if m.Command == "" {
+			m.Command = strings.ToUpper(param)
+		} else if param != "" {
+			m.Params = append(m.Params, param)
+		}
+	}
+	return m
+}
+
+var ircNickInvalid = regexp.MustCompile(`[^A-Za-z0-9_\-\[\]\\^{}|]`)
+
+// ircBridge relays messages between an IRC channel and a Nomi.
+type ircBridge struct {
+	conn    io.ReadWriter
+	nick    string
+	channel string
+	nomi    *nomiChannel
+
+	allMessages bool          // Relay every channel message, not only mentions
+	limiter     *rateLimiter  // Per-user message limit
+	maxLine     int           // Longest message payload sent, in bytes
+	lineDelay   time.Duration // Pause between sent lines, to avoid flood kicks
+
+	queue chan ircRequest
+}
+
+// ircRequest is a message waiting to be relayed to the Nomi.
+type ircRequest struct {
+	from   string
+	target string // Channel, or the sender's nick for private messages
+	text   string
+}
+
+func (b *ircBridge) send(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(b.conn, format+"\r\n", args...)
+	return err
+}
+
+// run registers, joins the channel and relays messages until the connection
+// closes.
+func (b *ircBridge) run() error {
+	b.queue = make(chan ircRequest, 32)
+	defer close(b.queue)
+	go b.relay()
+
+	if err := b.send("NICK %s", b.nick); err != nil {
+		return err
+	}
+	if err := b.send("USER %s 0 * :nomi-cli bridge", b.nick); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(b.conn)
+	for scanner.Scan() {
+		m := parseIRCMessage(scanner.Text())
+		switch m.Command {
+		case "PING":
+			b.send("PONG :%s", strings.Join(m.Params, " "))
+		case "001": // Registered
+			b.send("JOIN %s", b.channel)
+			fmt.Printf("Connected as %s, joining %s\n", b.nick, b.channel)
+		case "433": // Nickname in use
+			b.nick += "_"
+			b.send("NICK %s", b.nick)
+		case "PRIVMSG":
+			if len(m.Params) == 2 {
+				b.handlePrivmsg(m.Nick(), m.Params[0], m.Params[1])
+			}
+		case "ERROR":
+			return fmt.Errorf("server closed the connection: %s", strings.Join(m.Params, " "))
+		}
+	}
+	return scanner.Err()
+}
+
+// handlePrivmsg decides whether a message is for the Nomi and queues it.
+func (b *ircBridge) handlePrivmsg(from, target, text string) {
+	if strings.EqualFold(from, b.nick) {
+		return
+	}
+
+	private := strings.EqualFold(target, b.nick)
+	if !private && !strings.EqualFold(target, b.channel) {
+		return
+	}
+
+	text, mentioned := b.stripMention(text)
+	if !private && !mentioned && !b.allMessages {
+		return
+	}
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+
+	replyTo := b.channel
+	if private {
+		replyTo = from
+	}
+	if !b.limiter.allow(strings.ToLower(from), time.Now()) {
+		b.send("NOTICE %s :You are sending messages too fast, please slow down.", from)
+		return
+	}
+
+	select {
+	case b.queue <- ircRequest{from: from, target: replyTo, text: text}:
+	default:
+		b.send("NOTICE %s :Too many pending messages, please try again later.", from)
+	}
+}
+
+// stripMention removes a leading "nick:" or "nick," address and reports
+// whether the message mentions the Nomi's nick.
+func (b *ircBridge) stripMention(text string) (string, bool) {
+	// Compare as many characters as the nick has, as lowercasing can change
+	// their length in bytes
+	prefix := runePrefix(text, utf8.RuneCountInString(b.nick))
+	if strings.EqualFold(prefix, b.nick) {
+		rest := text[len(prefix):]
+		if strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, ",") {
+			return strings.TrimSpace(rest[1:]), true
+		}
+	}
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-[]\\^{}|", r))
+	})
+	for _, word := range words {
+		if strings.EqualFold(word, b.nick) {
+			return text, true
+		}
+	}
+	return text, false
+}
+
+// runePrefix returns the first n characters of s, or all of s if shorter.
+func runePrefix(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// relay sends queued messages to the Nomi one at a time and posts replies.
+func (b *ircBridge) relay() {
+	for request := range b.queue {
+		chatResponse, err := b.nomi.Send(fmt.Sprintf("%s: %s", request.from, request.text))
+		if err != nil {
+			fmt.Println(err)
+			b.send("NOTICE %s :Sorry, I couldn't get a reply (%v)", request.from, err)
+			continue
+		}
+
+		reply := chatResponse.ReplyMessage.Text
+		if request.target == b.channel {
+			reply = request.from + ": " + reply
+		}
+		for _, line := range splitLines(reply, b.maxLine) {
+			b.send("PRIVMSG %s :%s", request.target, line)
+			time.Sleep(b.lineDelay)
+		}
+	}
+}
+
+var ircServer string
+var ircChannel string
+var ircNomi string
+var ircNick string
+var ircTLS bool
+var ircAllMessages bool
+var ircRateLimit int
+
+var bridgeIRCCmd = &cobra.Command{
+	Use:   "irc",
+	Short: "Bridge a Nomi into an IRC channel",
+	Long: `Bridge a Nomi into an IRC channel.
+
+The Nomi joins the channel under its own nick (or --nick). By default it
+answers messages mentioning its nick ("Alice: hello") and private messages;
+with --all it answers every channel message. Messages are sent to the Nomi
+prefixed with the sender's nick, one at a time, and long replies are split
+across several lines.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if ircServer == "" || ircChannel == "" || ircNomi == "" {
+			fmt.Println("Error: --server, --channel and --nomi are required")
+			return
+		}
+
+		channel, err := openNomiChannel(ircNomi, nil)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer channel.Close()
+
+		nick := ircNick
+		if nick == "" {
+			nick = ircNickInvalid.ReplaceAllString(channel.Nomi.Name, "")
+		}
+		if nick == "" {
+			nick = "nomi"
+		}
+
+		var conn net.Conn
+		if ircTLS {
+			conn, err = tls.Dial("tcp", ircServer, nil)
+		} else {
+			conn, err = net.Dial("tcp", ircServer)
+		}
+		if err != nil {
+			fmt.Println("Error connecting to IRC server:", err)
+			return
+		}
+		defer conn.Close()
+
+		bridge := &ircBridge{
+			conn:        conn,
+			nick:        nick,
+			channel:     ircChannel,
+			nomi:        channel,
+			allMessages: ircAllMessages,
+			limiter:     newRateLimiter(ircRateLimit, time.Minute),
+			maxLine:     400,
+			lineDelay:   500 * time.Millisecond,
+		}
+		if err := bridge.run(); err != nil {
+			fmt.Println("Error:", err)
+		}
+	},
+}
+
+func init() {
+	bridgeIRCCmd.Flags().StringVar(&ircServer, "server", "", "IRC server address (host:port)")
+	bridgeIRCCmd.Flags().StringVar(&ircChannel, "channel", "", "Channel to join, e.g. #team")
+	bridgeIRCCmd.Flags().StringVar(&ircNomi, "nomi", "", "Nomi to bridge (UUID, UUID prefix or name)")
+	bridgeIRCCmd.Flags().StringVar(&ircNick, "nick", "", "IRC nick (defaults to the Nomi's name)")
+	bridgeIRCCmd.Flags().BoolVar(&ircTLS, "tls", false, "Connect using TLS")
+	bridgeIRCCmd.Flags().BoolVar(&ircAllMessages, "all", false, "Answer every channel message, not only mentions")
+	bridgeIRCCmd.Flags().IntVar(&ircRateLimit, "rate-limit", 5, "Messages per user per minute (0 for no limit)")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseIRCMessage(t *testing.T) {
+	m := parseIRCMessage(":bob!b@host PRIVMSG #team :Alice: how are you?\r\n")
+	if m.Nick() != "bob" || m.Command != "PRIVMSG" || len(m.Params) != 2 ||
+		m.Params[0] != "#team" || m.Params[1] != "Alice: how are you?" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+
+	m = parseIRCMessage("PING :irc.example.com")
+	if m.Command != "PING" || m.Params[0] != "irc.example.com" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	lines := splitLines("Hello there friend\n\nsecond paragraph", 12)
+	expected := []string{"Hello there", "friend", "second", "paragraph"}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+
+	// Long words are cut without breaking UTF-8 sequences
+	for _, line := range splitLines(strings.Repeat("é", 10), 5) {
+		if len(line) > 5 || !strings.HasPrefix(line, "é") {
+			t.Errorf("Invalid split line %q", line)
+		}
+	}
+}
+
+func TestStripMention(t *testing.T) {
+	b := &ircBridge{nick: "Åsa"}
+	tests := []struct {
+		text      string
+		want      string
+		mentioned bool
+	}{
+		{"åsa: hej", "hej", true},
+		{"ÅSA, hej", "hej", true},
+		{"hej Åsa", "hej Åsa", true},
+		{"İsa: hej", "İsa: hej", false},
+		{"Ås", "Ås", false},
+	}
+	for _, test := range tests {
+		got, mentioned := b.stripMention(test.text)
+		if got != test.want || mentioned != test.mentioned {
+			t.Errorf("stripMention(%q) = %q, %v, want %q, %v", test.text, got, mentioned, test.want, test.mentioned)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, time.Minute)
+	now := time.Now()
+	if !limiter.allow("bob", now) || !limiter.allow("bob", now) {
+		t.Error("Expected the first two messages to be allowed")
+	}
+	if limiter.allow("bob", now) {
+		t.Error("Expected the third message to be limited")
+	}
+	if !limiter.allow("carol", now) {
+		t.Error("Expected limits to be per user")
+	}
+	if !limiter.allow("bob", now.Add(time.Minute)) {
+		t.Error("Expected the limit to reset after the window")
+	}
+}
+
+func TestIRCBridge(t *testing.T) {
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer listener.Close()
+
+	// A minimal IRC server driving the conversation
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var lines []string
+		read := func() string {
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			line, _ := reader.ReadString('\n')
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			return line
+		}
+
+		read() // NICK
+		read() // USER
+		fmt.Fprint(conn, ":irc.local 001 Alice :Welcome\r\n")
+		read() // JOIN
+		fmt.Fprint(conn, "PING :irc.local\r\n")
+		read() // PONG
+		fmt.Fprint(conn, ":bob!b@host PRIVMSG #team :unrelated chatter\r\n")
+		fmt.Fprint(conn, ":bob!b@host PRIVMSG #team :alice, hello\r\n")
+		read() // Reply
+		received <- lines
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer conn.Close()
+
+	channel, err := openNomiChannel("Alice", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	bridge := &ircBridge{
+		conn:    conn,
+		nick:    "Alice",
+		channel: "#team",
+		nomi:    channel,
+		limiter: newRateLimiter(0, time.Minute),
+		maxLine: 400,
+	}
+	go bridge.run()
+
+	select {
+	case lines := <-received:
+		expected := []string{
+			"NICK Alice",
+			"USER Alice 0 * :nomi-cli bridge",
+			"JOIN #team",
+			"PONG :irc.local",
+			"PRIVMSG #team :bob: You said: bob: hello",
+		}
+		if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("Expected %q, got %q", expected, lines)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the bridge")
+	}
+}
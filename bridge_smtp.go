@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+// smtpMaxMessageSize bounds the size of accepted emails.
+const smtpMaxMessageSize = 1 << 20
+
+// smtpBridge accepts emails for <nomi-name>@<domain>, sends their text to the
+// Nomi and emails the reply back to the sender.
+type smtpBridge struct {
+	domain   string   // Accepted recipient domain; empty accepts any
+	senders  []string // Addresses, or "@domain", allowed to email the Nomis
+	hostname string
+	sendMail func(from string, to []string, msg []byte) error
+	logf     func(format string, args ...interface{})
+}
+
+// inboundMail is an accepted email waiting to be answered.
+type inboundMail struct {
+	from       string
+	recipients []string
+	data       []byte
+}
+
+// serve handles SMTP sessions until the listener is closed.
+func (b *smtpBridge) serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go b.session(conn)
+	}
+}
+
+// session implements the minimal SMTP dialogue needed to receive mail.
+func (b *smtpBridge) session(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	var mail inboundMail
+	reply("220 %s ESMTP nomi-cli", b.hostname)
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			reply("250 %s", b.hostname)
+		case "EHLO":
+			reply("250-%s", b.hostname)
+			reply("250-8BITMIME")
+			reply("250 SIZE %d", smtpMaxMessageSize)
+		case "MAIL":
+			from := smtpPath(arg, "FROM:")
+			if !b.allowed(from) {
+				reply("550 sender %s not allowed", from)
+				continue
+			}
+			mail = inboundMail{from: from}
+			reply("250 OK")
+		case "RCPT":
+			recipient := smtpPath(arg, "TO:")
+			if _, _, err := b.recipientNomi(recipient); err != nil {
+				reply("550 %v", err)
+				continue
+			}
+			mail.recipients = append(mail.recipients, recipient)
+			reply("250 OK")
+		case "DATA":
+			if mail.from == "" || len(mail.recipients) == 0 {
+				reply("503 MAIL and RCPT first")
+				continue
+			}
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data, err := readSMTPData(reader)
+			if err != nil {
+				reply("552 %v", err)
+				return
+			}
+			mail.data = data
+			reply("250 OK queued")
+			go b.answer(mail)
+			mail = inboundMail{}
+		case "RSET":
+			mail = inboundMail{}
+			reply("250 OK")
+		case "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// smtpPath extracts the address from "FROM:<a@b> SIZE=..." style arguments.
+func smtpPath(arg, prefix string) string {
+	arg = strings.TrimSpace(arg)
+	if len(arg) >= len(prefix) && strings.EqualFold(arg[:len(prefix)], prefix) {
+		arg = strings.TrimSpace(arg[len(prefix):])
+	}
+	if i := strings.Index(arg, ">"); strings.HasPrefix(arg, "<") && i > 0 {
+		return arg[1:i]
+	}
+	address, _, _ := strings.Cut(arg, " ")
+	return address
+}
+
+// readSMTPData reads the message until the lone "." line, undoing dot
+// stuffing.
+func readSMTPData(reader *bufio.Reader) ([]byte, error) {
+	var data bytes.Buffer
+	tooLarge := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			break
+		}
+		line = strings.TrimPrefix(line, ".")
+		if data.Len()+len(line) > smtpMaxMessageSize {
+			tooLarge = true
+			continue
+		}
+		data.WriteString(line)
+	}
+	if tooLarge {
+		return nil, fmt.Errorf("message exceeds %d bytes", smtpMaxMessageSize)
+	}
+	return data.Bytes(), nil
+}
+
+// allowed reports whether address may email the Nomis and get replies: it is
+// listed, or its domain is listed as "@domain". Sender addresses are easily
+// forged, so this only keeps replies from going to arbitrary addresses.
+func (b *smtpBridge) allowed(address string) bool {
+	_, domain, ok := strings.Cut(address, "@")
+	if !ok {
+		return false
+	}
+	for _, sender := range b.senders {
+		if strings.EqualFold(sender, address) || strings.EqualFold(sender, "@"+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeMailName reduces a name to lowercase letters and digits, so
+// "john.smith" matches "John Smith".
+func normalizeMailName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// recipientNomi finds the Nomi an address is for: the one whose name, less
+// case and punctuation, or UUID is the local part. Other addresses are rejected
+// rather than guessed at, so a typo doesn't mail someone else's Nomi.
+func (b *smtpBridge) recipientNomi(address string) (Nomi, string, error) {
+	local, domain, ok := strings.Cut(address, "@")
+	if !ok || local == "" {
+		return Nomi{}, "", fmt.Errorf("invalid address %s", address)
+	}
+	if b.domain != "" && !strings.EqualFold(domain, b.domain) {
+		return Nomi{}, "", fmt.Errorf("relaying to %s not allowed", domain)
+	}
+
+	nomis, err := fetchNomis()
+	if err != nil {
+		return Nomi{}, "", err
+	}
+	for _, nomi := range nomis {
+		if normalizeMailName(nomi.Name) == normalizeMailName(local) || strings.EqualFold(nomi.UUID, local) {
+			return nomi, address, nil
+		}
+	}
+	return Nomi{}, "", fmt.Errorf("no Nomi for %s", address)
+}
+
+// answer sends the email text to each recipient Nomi and mails the replies.
+// Text over the message length limit is sent in several messages, and their
+// replies are mailed together.
+func (b *smtpBridge) answer(inbound inboundMail) {
+	msg, err := mail.ReadMessage(bytes.NewReader(inbound.data))
+	if err != nil {
+		b.logf("Error parsing email from %s: %v", inbound.from, err)
+		return
+	}
+	text, err := plainTextBody(msg)
+	if err != nil {
+		b.logf("Error reading email from %s: %v", inbound.from, err)
+		return
+	}
+	text = stripQuotedReply(text)
+	if text == "" {
+		b.logf("Ignoring empty email from %s", inbound.from)
+		return
+	}
+
+	replyTo := inbound.from
+	if list, err := msg.Header.AddressList("Reply-To"); err == nil && len(list) > 0 {
+		replyTo = list[0].Address
+	}
+	if !b.allowed(replyTo) {
+		b.logf("Not replying to %s's email: %s is not an allowed sender", inbound.from, replyTo)
+		return
+	}
+
+	for _, recipient := range inbound.recipients {
+		nomi, address, err := b.recipientNomi(recipient)
+		if err != nil {
+			b.logf("Error: %v", err)
+			continue
+		}
+		var replies []string
+		channel := newNomiChannel(nomi)
+		for _, part := range splitMessage(text, maxMessageLength) {
+			chatResponse, err := channel.Send(part)
+			if err != nil {
+				b.logf("Error sending %s's email to %s: %v", inbound.from, nomi.Name, err)
+				break
+			}
+			replies = append(replies, chatResponse.ReplyMessage.Text)
+		}
+		channel.Close()
+		if len(replies) == 0 {
+			continue
+		}
+
+		reply := b.composeReply(msg.Header, nomi, address, replyTo, strings.Join(replies, "\n\n"))
+		if err := b.sendMail(address, []string{replyTo}, reply); err != nil {
+			b.logf("Error emailing %s's reply to %s: %v", nomi.Name, replyTo, err)
+			continue
+		}
+		b.logf("%s replied to %s", nomi.Name, replyTo)
+	}
+}
+
+// plainTextBody returns the text/plain content of a message, looking inside
+// multipart messages and decoding transfer encodings.
+func plainTextBody(msg *mail.Message) (string, error) {
+	return plainTextPart(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+}
+
+func plainTextPart(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return "", fmt.Errorf("no plain text part")
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := plainTextPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err == nil {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", fmt.Errorf("unsupported content type %s", mediaType)
+	}
+
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	data, err := io.ReadAll(body)
+	return string(data), err
+}
+
+// stripQuotedReply removes quoted lines, the "On ... wrote:" line introducing
+// them and the signature.
+func stripQuotedReply(text string) string {
+	var kept []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if line == "-- " || line == "--" {
+			break
+		}
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	for len(kept) > 0 {
+		last := strings.TrimSpace(kept[len(kept)-1])
+		if last == "" || (strings.HasPrefix(last, "On ") && strings.HasSuffix(last, "wrote:")) {
+			kept = kept[:len(kept)-1]
+			continue
+		}
+		break
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// composeReply builds the reply email, threaded under the original.
+func (b *smtpBridge) composeReply(original mail.Header, nomi Nomi, from, to, text string) []byte {
+	subject := original.Get("Subject")
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+
+	id := make([]byte, 12)
+	rand.Read(id)
+	_, domain, _ := strings.Cut(from, "@")
+
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+	}
+	header("From", (&mail.Address{Name: nomi.Name, Address: from}).String())
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), domain))
+	if messageID := original.Get("Message-ID"); messageID != "" {
+		header("In-Reply-To", messageID)
+		header("References", strings.TrimSpace(original.Get("References")+" "+messageID))
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	msg.WriteString("\r\n")
+
+	writer := quotedprintable.NewWriter(&msg)
+	writer.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n")))
+	writer.Close()
+	msg.WriteString("\r\n")
+	return msg.Bytes()
+}
+
+var bridgeSMTPListen string
+var bridgeSMTPRelay string
+var bridgeSMTPDomain string
+var bridgeSMTPAllow []string
+
+var bridgeSMTPCmd = &cobra.Command{
+	Use:   "smtp",
+	Short: "Let people email Nomis through a local SMTP listener",
+	Long: `Let people email Nomis through a local SMTP listener.
+
+Mail addressed to <nomi-name>@<domain> (e.g. john.smith@nomi.example.com for
+"John Smith") is accepted, its plain-text body (without quoted text and
+signature) is sent to the Nomi and the reply is emailed back to the sender
+through --relay, threaded under the original message. A body over the
+600-character message limit is sent as several messages, whose replies are
+emailed together. Mail to an address that names no Nomi exactly is rejected.
+
+Only senders given with --allow, as an address or "@domain", can email the
+Nomis, and replies only go to them.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if bridgeSMTPRelay == "" {
+			fmt.Println("Error: --relay is required")
+			return
+		}
+		if len(bridgeSMTPAllow) == 0 {
+			fmt.Println("Error: --allow is required, e.g. --allow you@example.com")
+			return
+		}
+		listener, err := net.Listen("tcp", bridgeSMTPListen)
+		if err != nil {
+			fmt.Println("Error listening:", err)
+			return
+		}
+		defer listener.Close()
+
+		hostname := bridgeSMTPDomain
+		if hostname == "" {
+			hostname = "localhost"
+		}
+		bridge := &smtpBridge{
+			domain:   bridgeSMTPDomain,
+			senders:  bridgeSMTPAllow,
+			hostname: hostname,
+			sendMail: func(from string, to []string, msg []byte) error {
+				return smtp.SendMail(bridgeSMTPRelay, nil, from, to, msg)
+			},
+			logf: func(format string, args ...interface{}) {
+				fmt.Printf("%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+			},
+		}
+		fmt.Printf("SMTP bridge listening on %s, relaying replies through %s\n", bridgeSMTPListen, bridgeSMTPRelay)
+		if err := bridge.serve(listener); err != nil {
+			fmt.Println("Error:", err)
+		}
+	},
+}
+
+func init() {
+	bridgeSMTPCmd.Flags().StringVar(&bridgeSMTPListen, "listen", "localhost:2525", "Address to listen on")
+	bridgeSMTPCmd.Flags().StringVar(&bridgeSMTPRelay, "relay", "", "SMTP relay (host:port) used to send replies")
+	bridgeSMTPCmd.Flags().StringVar(&bridgeSMTPDomain, "domain", "", "Domain of the Nomi addresses (default: any)")
+	bridgeSMTPCmd.Flags().StringArrayVar(&bridgeSMTPAllow, "allow", nil, `Sender allowed to email the Nomis, as an address or "@domain" (repeatable)`)
+}
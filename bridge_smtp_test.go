@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/smtp"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStripQuotedReply(t *testing.T) {
+	text := "Hello Alice!\r\nHow are you?\r\n\r\nOn Mon, Jan 1, 2024 Alice wrote:\r\n> Hi\r\n-- \r\nCarol"
+	if got := stripQuotedReply(text); got != "Hello Alice!\nHow are you?" {
+		t.Errorf("Unexpected text %q", got)
+	}
+}
+
+func TestPlainTextBodyMultipart(t *testing.T) {
+	raw := "Content-Type: multipart/alternative; boundary=b1\r\n\r\n" +
+		"--b1\r\nContent-Type: text/html\r\n\r\n<p>Hi</p>\r\n" +
+		"--b1\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nCaf=C3=A9?\r\n" +
+		"--b1--\r\n"
+	msg, _ := mail.ReadMessage(strings.NewReader(raw))
+	text, err := plainTextBody(msg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if strings.TrimSpace(text) != "Café?" {
+		t.Errorf("Unexpected text %q", text)
+	}
+}
+
+func TestSMTPBridge(t *testing.T) {
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+
+	type sent struct {
+		from string
+		to   []string
+		msg  []byte
+	}
+	outbox := make(chan sent, 1)
+	bridge := &smtpBridge{
+		domain:   "nomi.test",
+		senders:  []string{"carol@example.com", "@team.test"},
+		hostname: "nomi.test",
+		sendMail: func(from string, to []string, msg []byte) error {
+			outbox <- sent{from, to, msg}
+			return nil
+		},
+		logf: func(string, ...interface{}) {},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer listener.Close()
+	go bridge.serve(listener)
+
+	// Unknown Nomis, foreign domains and senders not allowed are refused
+	for _, to := range []string{"zed@nomi.test", "alice@other.test"} {
+		if err := smtp.SendMail(listener.Addr().String(), nil, "carol@example.com", []string{to}, []byte("Subject: x\r\n\r\nx\r\n")); err == nil {
+			t.Errorf("Expected %s to be refused", to)
+		}
+	}
+	if err := smtp.SendMail(listener.Addr().String(), nil, "mallory@example.com", []string{"alice@nomi.test"}, []byte("Subject: x\r\n\r\nx\r\n")); err == nil {
+		t.Error("Expected a sender not allowed to be refused")
+	}
+
+	original := "From: Carol <carol@example.com>\r\n" +
+		"To: alice@nomi.test\r\n" +
+		"Subject: Weekend\r\n" +
+		"Message-ID: <orig-1@example.com>\r\n" +
+		"\r\n" +
+		"Any plans?\r\n.dot-stuffed line\r\n"
+	if err := smtp.SendMail(listener.Addr().String(), nil, "carol@example.com", []string{"alice@nomi.test"}, []byte(original)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	select {
+	case reply := <-outbox:
+		if reply.from != "alice@nomi.test" || len(reply.to) != 1 || reply.to[0] != "carol@example.com" {
+			t.Errorf("Unexpected envelope: from %s to %v", reply.from, reply.to)
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(reply.msg))
+		if err != nil {
+			t.Fatalf("Error parsing reply: %v", err)
+		}
+		if msg.Header.Get("Subject") != "Re: Weekend" ||
+			msg.Header.Get("In-Reply-To") != "<orig-1@example.com>" ||
+			msg.Header.Get("References") != "<orig-1@example.com>" ||
+			msg.Header.Get("From") != `"Alice" <alice@nomi.test>` {
+			t.Errorf("Unexpected reply headers: %v", msg.Header)
+		}
+		body, _ := plainTextBody(msg)
+		if strings.TrimSpace(body) != "You said: Any plans?\r\n.dot-stuffed line" {
+			t.Errorf("Unexpected reply body %q", body)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Expected a reply email")
+	}
+}
+
+func TestSMTPBridgeReplies(t *testing.T) {
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+
+	var replies [][]byte
+	bridge := &smtpBridge{
+		senders: []string{"@team.test"},
+		sendMail: func(from string, to []string, msg []byte) error {
+			replies = append(replies, msg)
+			return nil
+		},
+		logf: func(string, ...interface{}) {},
+	}
+
+	// Replies never go to a Reply-To outside the allowed senders
+	bridge.answer(inboundMail{
+		from:       "dave@team.test",
+		recipients: []string{"alice@nomi.test"},
+		data:       []byte("From: dave@team.test\r\nReply-To: eve@evil.test\r\nSubject: Hi\r\n\r\nHello\r\n"),
+	})
+	if len(replies) != 0 {
+		t.Fatalf("Expected no reply to a Reply-To not allowed, got %q", replies)
+	}
+
+	// A long body is sent in several messages, answered in one email
+	body := strings.Repeat("This sentence is here to fill the email. ", 20)
+	bridge.answer(inboundMail{
+		from:       "dave@team.test",
+		recipients: []string{"alice@nomi.test"},
+		data:       []byte("From: dave@team.test\r\nSubject: Long\r\n\r\n" + body + "\r\n"),
+	})
+	if len(replies) != 1 {
+		t.Fatalf("Expected one reply email, got %d", len(replies))
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(replies[0]))
+	if err != nil {
+		t.Fatalf("Error parsing reply: %v", err)
+	}
+	text, _ := plainTextBody(msg)
+	if n := strings.Count(text, "You said: "); n != 2 {
+		t.Errorf("Expected the replies to 2 messages, got %d in %q", n, text)
+	}
+}
+
+func TestSMTPRecipientNomi(t *testing.T) {
+	mock := newMockServer()
+	api := httptest.NewServer(mock.handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	bridge := &smtpBridge{domain: "nomi.test"}
+	for address, want := range map[string]string{
+		"alice@nomi.test":                 "Alice",
+		"ALICE@Nomi.Test":                 "Alice",
+		mock.nomis[1].UUID + "@nomi.test": "Bob",
+		"ali@nomi.test":                   "",
+		"lce@nomi.test":                   "",
+		"alice@other.test":                "",
+	} {
+		nomi, _, err := bridge.recipientNomi(address)
+		if want == "" {
+			if err == nil {
+				t.Errorf("Expected %s to be rejected, got %s", address, nomi.Name)
+			}
+		} else if err != nil || nomi.Name != want {
+			t.Errorf("Expected %s for %s, got %q (%v)", want, address, nomi.Name, err)
+		}
+	}
+}
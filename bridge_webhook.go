@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// chatWebhookPayload is the subset of Slack and Mattermost outgoing-webhook
+// and slash-command payloads the bridge uses. Both services send it either
+// form-encoded or as JSON.
+type chatWebhookPayload struct {
+	Token       string `json:"token"`
+	ChannelName string `json:"channel_name"`
+	UserName    string `json:"user_name"`
+	Text        string `json:"text"`
+	TriggerWord string `json:"trigger_word"`
+	Command     string `json:"command"`
+}
+
+// chatWebhookReply is the message posted back, inline or to the incoming
+// webhook.
+type chatWebhookReply struct {
+	Text         string `json:"text"`
+	Username     string `json:"username,omitempty"`
+	Channel      string `json:"channel,omitempty"`
+	ResponseType string `json:"response_type,omitempty"`
+}
+
+// webhookBridge forwards chat webhook messages to Nomis.
+type webhookBridge struct {
+	token       string // Expected payload token; empty accepts any
+	defaultNomi string // Nomi used when the message doesn't name one
+	command     string // Routing prefix in message text, e.g. "/nomi"
+	incomingURL string // Post replies here instead of answering inline
+	client      *http.Client
+}
+
+func parseChatWebhookPayload(r *http.Request) (chatWebhookPayload, error) {
+	var payload chatWebhookPayload
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		return payload, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return payload, err
+	}
+	payload.Token = r.PostForm.Get("token")
+	payload.ChannelName = r.PostForm.Get("channel_name")
+	payload.UserName = r.PostForm.Get("user_name")
+	payload.Text = r.PostForm.Get("text")
+	payload.TriggerWord = r.PostForm.Get("trigger_word")
+	payload.Command = r.PostForm.Get("command")
+	return payload, nil
+}
+
+// route picks the Nomi and the message text. Slash commands and messages
+// starting with the routing prefix name the Nomi first ("/nomi Alice hello");
+// other messages go to the default Nomi. The first word must be a Nomi's
+// whole name or UUID, as a partial match would take ordinary words for
+// names: when it names no Nomi, or several, the whole text goes to the
+// default Nomi too, or the lookup error is returned if there is none.
+func (b *webhookBridge) route(payload chatWebhookPayload, nomis []Nomi) (Nomi, string, error) {
+	text := strings.TrimSpace(payload.Text)
+	if payload.TriggerWord != "" {
+		text = strings.TrimSpace(strings.TrimPrefix(text, payload.TriggerWord))
+	}
+
+	routed := payload.Command != ""
+	if b.command != "" && strings.HasPrefix(text, b.command+" ") {
+		text = strings.TrimSpace(strings.TrimPrefix(text, b.command))
+		routed = true
+	}
+
+	if routed {
+		name, rest, _ := strings.Cut(text, " ")
+		nomi, err := matchNomiExactly(nomis, name)
+		if err == nil {
+			return nomi, strings.TrimSpace(rest), nil
+		}
+		if b.defaultNomi == "" {
+			return Nomi{}, "", err
+		}
+	}
+
+	if b.defaultNomi == "" {
+		return Nomi{}, "", fmt.Errorf("please name a Nomi, e.g. %s Alice hello", b.command)
+	}
+	nomi, err := matchNomi(nomis, b.defaultNomi)
+	return nomi, text, err
+}
+
+func (b *webhookBridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	payload, err := parseChatWebhookPayload(r)
+	if err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if b.token != "" && subtle.ConstantTimeCompare([]byte(payload.Token), []byte(b.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	nomis, err := fetchNomis()
+	if err != nil {
+		b.respond(w, chatWebhookReply{Text: err.Error()}, true)
+		return
+	}
+	nomi, text, err := b.route(payload, nomis)
+	if err != nil {
+		b.respond(w, chatWebhookReply{Text: err.Error()}, true)
+		return
+	}
+	if text == "" {
+		b.respond(w, chatWebhookReply{Text: fmt.Sprintf("What do you want to tell %s?", nomi.Name)}, true)
+		return
+	}
+
+	send := func() chatWebhookReply {
+		channel := newNomiChannel(nomi)
+		defer channel.Close()
+		chatResponse, err := channel.Send(text)
+		if err != nil {
+			return chatWebhookReply{Text: fmt.Sprintf("%s couldn't reply: %v", nomi.Name, err)}
+		}
+		return chatWebhookReply{Text: chatResponse.ReplyMessage.Text, Username: nomi.Name, ResponseType: "in_channel"}
+	}
+
+	// With an incoming webhook, acknowledge right away so slow replies don't
+	// hit the chat service's response timeout.
+	if b.incomingURL != "" {
+		w.WriteHeader(http.StatusOK)
+		go func() {
+			reply := send()
+			reply.Channel = payload.ChannelName
+			if err := b.post(reply); err != nil {
+				fmt.Println("Error posting reply:", err)
+			}
+		}()
+		return
+	}
+	b.respond(w, send(), false)
+}
+
+// respond answers inline. Private replies, used for errors, are only shown to
+// the sender where the chat service supports it.
+func (b *webhookBridge) respond(w http.ResponseWriter, reply chatWebhookReply, private bool) {
+	if private {
+		reply.ResponseType = "ephemeral"
+	}
+	writeJSON(w, reply)
+}
+
+func (b *webhookBridge) post(reply chatWebhookReply) error {
+	body, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	resp, err := b.client.Post(b.incomingURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("incoming webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+var bridgeWebhookListen string
+var bridgeWebhookNomi string
+var bridgeWebhookToken string
+var bridgeWebhookIncoming string
+var bridgeWebhookCommand string
+
+var bridgeWebhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Bridge Nomis to Slack/Mattermost-style webhooks",
+	Long: `Bridge Nomis to Slack/Mattermost-style webhooks.
+
+Configure an outgoing webhook or slash command in your chat service to POST to
+this listener. Slash commands and messages starting with /nomi (see --command)
+name the Nomi first, by its whole name or UUID: "/nomi Alice hello". Other
+messages go to --nomi, as do routed messages whose first word is not the name
+of exactly one Nomi.
+
+Replies are returned inline in the HTTP response, or posted to
+--incoming-url when the chat service expects an incoming webhook.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if bridgeWebhookNomi != "" {
+			if _, err := resolveNomi(bridgeWebhookNomi); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+
+		bridge := &webhookBridge{
+			token:       bridgeWebhookToken,
+			defaultNomi: bridgeWebhookNomi,
+			command:     bridgeWebhookCommand,
+			incomingURL: bridgeWebhookIncoming,
+			client:      &http.Client{Timeout: 30 * time.Second},
+		}
+		fmt.Printf("Webhook bridge listening on %s\n", bridgeWebhookListen)
+		if err := http.ListenAndServe(bridgeWebhookListen, bridge); err != nil {
+			fmt.Println("Error running server:", err)
+		}
+	},
+}
+
+func init() {
+	bridgeWebhookCmd.Flags().StringVar(&bridgeWebhookListen, "listen", "localhost:8065", "Address to listen on")
+	bridgeWebhookCmd.Flags().StringVar(&bridgeWebhookNomi, "nomi", "", "Default Nomi for messages that don't name one")
+	bridgeWebhookCmd.Flags().StringVar(&bridgeWebhookToken, "token", "", "Token the chat service sends with each payload")
+	bridgeWebhookCmd.Flags().StringVar(&bridgeWebhookIncoming, "incoming-url", "", "Incoming webhook URL to post replies to")
+	bridgeWebhookCmd.Flags().StringVar(&bridgeWebhookCommand, "command", "/nomi", "Prefix routing a message to a named Nomi")
+}
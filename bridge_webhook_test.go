@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postForm(t *testing.T, server *httptest.Server, form url.Values) chatWebhookReply {
+	t.Helper()
+	resp, err := http.PostForm(server.URL, form)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer resp.Body.Close()
+	var reply chatWebhookReply
+	json.NewDecoder(resp.Body).Decode(&reply)
+	return reply
+}
+
+func TestWebhookBridgeInline(t *testing.T) {
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	bridge := &webhookBridge{token: "t0k", defaultNomi: "Alice", command: "/nomi", client: http.DefaultClient}
+	server := httptest.NewServer(bridge)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		username string
+		text     string
+	}{
+		{
+			name:     "Outgoing webhook to the default Nomi",
+			form:     url.Values{"token": {"t0k"}, "user_name": {"carol"}, "text": {"nomi: hi there"}, "trigger_word": {"nomi:"}},
+			username: "Alice",
+			text:     "You said: hi there",
+		},
+		{
+			name:     "Routing prefix in message text",
+			form:     url.Values{"token": {"t0k"}, "text": {"/nomi bob how are you?"}},
+			username: "Bob",
+			text:     "You said: how are you?",
+		},
+		{
+			name:     "Slash command",
+			form:     url.Values{"token": {"t0k"}, "command": {"/nomi"}, "text": {"Bob hello"}},
+			username: "Bob",
+			text:     "You said: hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := postForm(t, server, tt.form)
+			if reply.Username != tt.username || reply.Text != tt.text || reply.ResponseType != "in_channel" {
+				t.Errorf("Unexpected reply: %+v", reply)
+			}
+		})
+	}
+
+	resp, _ := http.PostForm(server.URL, url.Values{"token": {"wrong"}, "text": {"hi"}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong token, got %s", resp.Status)
+	}
+}
+
+func TestWebhookBridgeRoute(t *testing.T) {
+	nomis := []Nomi{{UUID: "1", Name: "Alice"}, {UUID: "2", Name: "Alina"}, {UUID: "3", Name: "Bob"}, {UUID: "4", Name: "Sam"}, {UUID: "5", Name: "Sam"}}
+	bridge := &webhookBridge{defaultNomi: "Bob", command: "/nomi"}
+
+	if nomi, message, err := bridge.route(chatWebhookPayload{Text: "/nomi alice hello"}, nomis); err != nil || nomi.Name != "Alice" || message != "hello" {
+		t.Errorf("route = %s, %q, %v, want hello for Alice", nomi.Name, message, err)
+	}
+
+	// A first word naming no Nomi, only part of one, or several is part of the message
+	for _, text := range []string{"/nomi Zed hello", "/nomi ali hello", "/nomi Sam hello"} {
+		nomi, message, err := bridge.route(chatWebhookPayload{Text: text}, nomis)
+		if err != nil || nomi.Name != "Bob" || message != strings.TrimPrefix(text, "/nomi ") {
+			t.Errorf("route(%q) = %s, %q, %v, want the whole text for Bob", text, nomi.Name, message, err)
+		}
+	}
+
+	bridge.defaultNomi = ""
+	if _, _, err := bridge.route(chatWebhookPayload{Text: "/nomi Sam hello"}, nomis); err == nil || !strings.Contains(err.Error(), "matches several Nomis") {
+		t.Errorf("Expected an ambiguous name error without a default Nomi, got %v", err)
+	}
+	for _, text := range []string{"/nomi Zed hello", "/nomi ali hello"} {
+		if _, _, err := bridge.route(chatWebhookPayload{Text: text}, nomis); err == nil || !strings.Contains(err.Error(), "no Nomi found") {
+			t.Errorf("Expected an unknown name error for %q without a default Nomi, got %v", text, err)
+		}
+	}
+}
+
+func TestWebhookBridgeIncomingURL(t *testing.T) {
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	posted := make(chan chatWebhookReply, 1)
+	incoming := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reply chatWebhookReply
+		json.NewDecoder(r.Body).Decode(&reply)
+		posted <- reply
+	}))
+	defer incoming.Close()
+
+	bridge := &webhookBridge{command: "/nomi", incomingURL: incoming.URL, client: http.DefaultClient}
+	server := httptest.NewServer(bridge)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json",
+		strings.NewReader(`{"channel_name":"town-square","text":"/nomi alice hello"}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+
+	select {
+	case reply := <-posted:
+		if reply.Username != "Alice" || reply.Text != "You said: hello" || reply.Channel != "town-square" {
+			t.Errorf("Unexpected reply: %+v", reply)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a reply on the incoming webhook")
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var recordDir string // Save every API interaction as a cassette in this directory
+var replayDir string // Serve API responses from the cassettes in this directory
+
+// interaction is a single recorded API exchange, stored as one JSON file in
+// the cassette directory. URLs are stored relative to baseURL so a cassette
+// can be replayed against any API URL.
+type interaction struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+}
+
+type recordedRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Body   string `json:"body,omitempty"`
+}
+
+type recordedResponse struct {
+	Status     string            `json:"status"`
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// matchKey identifies the requests an interaction can answer. JSON bodies are
+// compacted so formatting differences don't prevent a match.
+func (r recordedRequest) matchKey() string {
+	body := r.Body
+	var compact bytes.Buffer
+	if json.Compact(&compact, []byte(body)) == nil {
+		body = compact.String()
+	}
+	return r.Method + " " + r.Path + " " + body
+}
+
+// relativePath strips baseURL from a request URL.
+func relativePath(req *http.Request) string {
+	url := req.URL.String()
+	if baseURL != "" && strings.HasPrefix(url, baseURL) {
+		return strings.TrimPrefix(url, baseURL)
+	}
+	return req.URL.RequestURI()
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// recordTransport forwards requests and saves each exchange to dir.
+type recordTransport struct {
+	next http.RoundTripper
+	dir  string
+
+	mu  sync.Mutex
+	seq int
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		reqBody, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	rec := interaction{
+		Request: recordedRequest{
+			Method: req.Method,
+			Path:   relativePath(req),
+			Body:   string(reqBody),
+		},
+		Response: recordedResponse{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Body:       string(respBody),
+		},
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		rec.Response.Headers = map[string]string{"Content-Type": ct}
+	}
+	if err := t.save(rec); err != nil {
+		fmt.Fprintf(os.Stderr, "Error recording interaction: %v\n", err)
+	}
+	return resp, nil
+}
+
+// save writes rec to the next numbered file, continuing after any cassettes
+// already in the directory so several commands can record one session.
+func (t *recordTransport) save(rec interaction) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.seq == 0 {
+		if err := os.MkdirAll(t.dir, 0700); err != nil {
+			return err
+		}
+		existing, _ := filepath.Glob(filepath.Join(t.dir, "*.json"))
+		t.seq = len(existing)
+	}
+	t.seq++
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%04d-%s%s.json", t.seq, rec.Request.Method,
+		strings.TrimRight(unsafePathChars.ReplaceAllString(rec.Request.Path, "-"), "-"))
+	return os.WriteFile(filepath.Join(t.dir, name), data, 0600)
+}
+
+// replayTransport answers requests from recorded interactions without any
+// network access. Identical requests are answered in recording order; once a
+// request's recordings are used up the last one is served again.
+type replayTransport struct {
+	mu      sync.Mutex
+	pending map[string][]interaction
+	last    map[string]interaction
+}
+
+// loadCassettes reads every interaction in dir, in file name order.
+func loadCassettes(dir string) (*replayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no cassettes found in %s", dir)
+	}
+	sort.Strings(files)
+
+	t := &replayTransport{
+		pending: make(map[string][]interaction),
+		last:    make(map[string]interaction),
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var rec interaction
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("error decoding cassette %s: %v", file, err)
+		}
+		key := rec.Request.matchKey()
+		t.pending[key] = append(t.pending[key], rec)
+	}
+	return t, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		reqBody, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	key := recordedRequest{Method: req.Method, Path: relativePath(req), Body: string(reqBody)}.matchKey()
+
+	t.mu.Lock()
+	var rec interaction
+	if queue := t.pending[key]; len(queue) > 0 {
+		rec = queue[0]
+		t.pending[key] = queue[1:]
+		t.last[key] = rec
+	} else if prev, ok := t.last[key]; ok {
+		rec = prev
+	} else {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("no recorded interaction for %s %s", req.Method, relativePath(req))
+	}
+	t.mu.Unlock()
+
+	header := make(http.Header)
+	for name, value := range rec.Response.Headers {
+		header.Set(name, value)
+	}
+	return &http.Response{
+		Status:        rec.Response.Status,
+		StatusCode:    rec.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(rec.Response.Body)),
+		ContentLength: int64(len(rec.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// activeReplay is loaded once per process so repeated requests advance
+// through the same cassette queue regardless of which client sends them.
+// Clients are created concurrently (ask opens one per Nomi), hence the lock.
+var activeReplay *replayTransport
+var activeRecord *recordTransport
+var activeMu sync.Mutex
+
+// baseTransport returns the transport that talks to the API: the network,
+// possibly recorded, or a cassette replay.
+func baseTransport() (http.RoundTripper, error) {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	switch {
+	case replayDir != "":
+		if activeReplay == nil {
+			t, err := loadCassettes(replayDir)
+			if err != nil {
+				return nil, err
+			}
+			activeReplay = t
+		}
+		return activeReplay, nil
+	case recordDir != "":
+		if activeRecord == nil || activeRecord.dir != recordDir {
+			activeRecord = &recordTransport{next: http.DefaultTransport, dir: recordDir}
+		}
+		return activeRecord, nil
+	}
+	return http.DefaultTransport, nil
+}
+
+// failingTransport reports a setup error on every request.
+type failingTransport struct {
+	err error
+}
+
+func (t failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	replies := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/nomis":
+			json.NewEncoder(w).Encode(NomiResponse{Nomis: []Nomi{{UUID: "uuid-1", Name: "Alice"}}})
+		case "/nomis/uuid-1/chat":
+			replies++
+			json.NewEncoder(w).Encode(ChatResponse{ReplyMessage: Message{Text: strings.Repeat("hi", replies)}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	dir := t.TempDir()
+	originalBaseURL, originalRecord, originalReplay := baseURL, recordDir, replayDir
+	defer func() {
+		baseURL, recordDir, replayDir = originalBaseURL, originalRecord, originalReplay
+		activeRecord, activeReplay = nil, nil
+	}()
+
+	// Record a session against the live server
+	baseURL = server.URL
+	recordDir, replayDir = dir, ""
+	activeRecord = nil
+
+	if _, err := fetchNomis(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := newHTTPClient().Post(server.URL+"/nomis/uuid-1/chat", "application/json", strings.NewReader(`{"messageText":"hello"}`))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		resp.Body.Close()
+	}
+	server.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 cassettes, got %d", len(files))
+	}
+
+	// Replay against an unreachable URL
+	baseURL = "http://replay.invalid/v1"
+	recordDir, replayDir = "", dir
+	activeReplay = nil
+
+	nomis, err := fetchNomis()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(nomis) != 1 || nomis[0].Name != "Alice" {
+		t.Errorf("Unexpected replayed Nomis: %+v", nomis)
+	}
+
+	// Identical requests are answered in recording order, differently
+	// formatted JSON bodies still match
+	for _, expected := range []string{"hi", "hihi", "hihi"} {
+		resp, err := newHTTPClient().Post(baseURL+"/nomis/uuid-1/chat", "application/json", strings.NewReader(`{ "messageText": "hello" }`))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var chat ChatResponse
+		json.NewDecoder(resp.Body).Decode(&chat)
+		resp.Body.Close()
+		if chat.ReplyMessage.Text != expected {
+			t.Errorf("Expected reply %q, got %q", expected, chat.ReplyMessage.Text)
+		}
+	}
+
+	// Unknown requests fail instead of reaching the network
+	resp, err := newHTTPClient().Post(baseURL+"/nomis/uuid-1/chat", "application/json", strings.NewReader(`{"messageText":"other"}`))
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		t.Error("Expected error for unrecorded request")
+	}
+}
+
+func TestBaseTransportConcurrent(t *testing.T) {
+	originalRecord, originalReplay := recordDir, replayDir
+	defer func() {
+		recordDir, replayDir = originalRecord, originalReplay
+		activeRecord, activeReplay = nil, nil
+	}()
+	recordDir, replayDir = "", t.TempDir()
+	activeReplay = nil
+	cassette := `{"request":{"method":"GET","path":"/nomis"},"response":{"status":"200 OK","statusCode":200,"body":"{}"}}`
+	if err := os.WriteFile(filepath.Join(replayDir, "1.json"), []byte(cassette), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Clients created at the same time share one replay queue
+	transports := make(chan http.RoundTripper, 8)
+	for i := 0; i < cap(transports); i++ {
+		go func() {
+			transport, err := baseTransport()
+			if err != nil {
+				t.Error(err)
+			}
+			transports <- transport
+		}()
+	}
+	first := <-transports
+	for i := 1; i < cap(transports); i++ {
+		if transport := <-transports; transport != first {
+			t.Fatal("Expected every client to share the same replay transport")
+		}
+	}
+}
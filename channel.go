@@ -0,0 +1,89 @@
+package main
+
+import "errors"
+
+// nomiChannel sends messages to one Nomi, through the daemon when it is
+// running with the same settings and directly to the API otherwise.
+type nomiChannel struct {
+	Nomi   Nomi
+	daemon *daemonClient
+}
+
+// openNomiChannel resolves query and opens a channel to the Nomi. When the
+// daemon is used, onExchange (if not nil) receives the exchanges other
+// terminals have with the same Nomi.
+func openNomiChannel(query string, onExchange func(ChatResponse)) (*nomiChannel, error) {
+	daemon, err := dialMatchingDaemon()
+	if err != nil {
+		nomi, err := resolveNomi(query)
+		if err != nil {
+			return nil, err
+		}
+		return &nomiChannel{Nomi: nomi}, nil
+	}
+
+	nomi, err := daemon.resolve(query)
+	if err != nil {
+		daemon.Close()
+		return nil, err
+	}
+	if onExchange != nil {
+		if err := daemon.attach(nomi.UUID, onExchange); err != nil {
+			daemon.Close()
+			return nil, err
+		}
+	}
+	return &nomiChannel{Nomi: nomi, daemon: daemon}, nil
+}
+
+// newNomiChannel opens a channel to a Nomi already resolved.
+func newNomiChannel(nomi Nomi) *nomiChannel {
+	daemon, err := dialMatchingDaemon()
+	if err != nil {
+		return &nomiChannel{Nomi: nomi}
+	}
+	return &nomiChannel{Nomi: nomi, daemon: daemon}
+}
+
+// dialMatchingDaemon connects to the daemon if it is running with the same
+// settings as this command.
+func dialMatchingDaemon() (*daemonClient, error) {
+	daemon, err := dialDaemon()
+	if err != nil {
+		return nil, err
+	}
+	if !daemonMatches(daemon) {
+		daemon.Close()
+		return nil, errDaemonSettings
+	}
+	return daemon, nil
+}
+
+// errDaemonSettings is why a running daemon is passed over.
+var errDaemonSettings = errors.New("daemon uses different settings")
+
+// daemonMatches reports whether the daemon's requests would be the ones this
+// command makes itself: to the same API with the same key, and without
+// recording, replaying or tracing them, which only happen in this process.
+func daemonMatches(daemon *daemonClient) bool {
+	if recordDir != "" || replayDir != "" || debugHTTP || traceFile != "" {
+		return false
+	}
+	status, err := daemon.status()
+	return err == nil && status.APIURL == baseURL && status.KeyHash == apiKeyHash(apiKey)
+}
+
+// Send sends a message and returns the Nomi's reply.
+func (c *nomiChannel) Send(text string) (ChatResponse, error) {
+	if c.daemon != nil {
+		return c.daemon.send(c.Nomi.UUID, text)
+	}
+	return sendChat(c.Nomi, text)
+}
+
+// Close releases the daemon connection, if any.
+func (c *nomiChannel) Close() {
+	if c.daemon != nil {
+		c.daemon.Close()
+	}
+}
@@ -1,15 +1,12 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -30,14 +27,6 @@ type ChatResponse struct {
 	ReplyMessage Message `json:"replyMessage"`
 }
 
-const (
-	colorReset  = "\033[0m"
-	colorGreen  = "\033[32m"
-	colorBlue   = "\033[34m"
-	colorYellow = "\033[33m"
-	colorCyan   = "\033[36m"
-)
-
 // clearScreen clears the terminal screen and attempts to clear the scrollback buffer.
 func clearScreen() {
 	switch runtime.GOOS {
@@ -56,48 +45,6 @@ func clearScreen() {
 	}
 }
 
-// findNomiByName retrieves the UUID of a Nomi by its name.
-func findNomiByName(name string) (string, error) {
-	client := &http.Client{}
-	url := fmt.Sprintf("%s/nomis", baseURL) // Use dynamic baseURL
-
-	// Fetch the list of Nomis
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %v", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error making request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error fetching Nomis: %s", resp.Status)
-	}
-
-	var result struct {
-		Nomis []struct {
-			UUID string `json:"uuid"`
-			Name string `json:"name"`
-		} `json:"nomis"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("error decoding response: %v", err)
-	}
-
-	// Search for the Nomi by name
-	for _, nomi := range result.Nomis {
-		if strings.EqualFold(nomi.Name, name) { // Case-insensitive comparison
-			return nomi.UUID, nil
-		}
-	}
-
-	return "", fmt.Errorf("no Nomi found with the name: %s", name)
-}
-
 // spinner displays a spinning wheel animation while waiting for a response.
 func spinner(stopChan chan bool) {
 	chars := []string{"-", "\\", "|", "/"} // Simple classic spinner
@@ -111,7 +58,7 @@ func spinner(stopChan chan bool) {
 				case <-stopChan:
 					return
 				default:
-					fmt.Printf("\r%s%s%s", colorCyan, char, colorReset)
+					fmt.Printf("\r%s", paint(theme.Spinner, char))
 					time.Sleep(100 * time.Millisecond) // Slightly slower rotation
 				}
 			}
@@ -119,93 +66,427 @@ func spinner(stopChan chan bool) {
 	}
 }
 
+// Chat command flags.
+var (
+	chatRaw          bool   // Print replies without rendering
+	chatTimestamps   string // "", "absolute" or "relative"
+	chatLatency      bool   // Show how long each reply took
+	chatResume       bool   // Continue the last session with the Nomi
+	chatSessionName  string // Name of the session to continue or start
+	chatHistory      int    // Exchanges shown when continuing a session
+	chatNoSave       bool   // Don't save the session
+	chatLongMessages string // Strategy for messages over the length limit
+	chatVoice        bool   // Talk and listen with the speech commands
+	chatSTT          string // Speech-to-text command, overriding the config
+	chatTTS          string // Text-to-speech command, overriding the config
+)
+
+// chatExchange is a message and its reply in a chat session.
+type chatExchange struct {
+	Response ChatResponse
+	Latency  time.Duration // Zero for exchanges from other terminals
+}
+
+// chatView prints the messages of a chat session, with the metadata asked
+// for on the command line, and saves them. Replies may come from other
+// terminals while the user types, hence the lock.
+type chatView struct {
+	nomi    Nomi
+	start   time.Time
+	session *chatSession // Nil when the session is not saved
+
+	mu   sync.Mutex
+	last *chatExchange
+}
+
+// formatTimestamp formats when a message was sent, in local time or relative
+// to the start of the session.
+func (v *chatView) formatTimestamp(sent string) string {
+	t := parseAPITime(sent)
+	if elapsed := t.Sub(v.start).Round(time.Second); chatTimestamps == "relative" && elapsed >= 0 {
+		return "+" + elapsed.String()
+	}
+	t = t.Local()
+	if y, m, d := t.Date(); y == time.Now().Year() && m == time.Now().Month() && d == time.Now().Day() {
+		return t.Format("15:04:05")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// meta returns the bracketed metadata shown before a reply, if any.
+func (v *chatView) meta(exchange chatExchange) string {
+	var parts []string
+	if chatTimestamps != "" {
+		parts = append(parts, v.formatTimestamp(exchange.Response.ReplyMessage.Sent))
+	}
+	if chatLatency && exchange.Latency > 0 {
+		parts = append(parts, formatLatency(exchange.Latency))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(parts, " · ") + "] "
+}
+
+// formatLatency formats a reply time like "850ms" or "2.3s".
+func formatLatency(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// printReply prints a Nomi's reply, remembers the exchange for /info and
+// saves it in the session.
+func (v *chatView) printReply(exchange chatExchange) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.last = &exchange
+	v.render(exchange)
+
+	if v.session != nil {
+		if err := v.session.record(exchange); err != nil {
+			fmt.Println("Error saving session:", err)
+		}
+	}
+}
+
+// printHistory prints the last exchanges of the session being continued.
+func (v *chatView) printHistory(n int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	history := v.session.last(n)
+	if len(history) == 0 {
+		return
+	}
+
+	fmt.Println(paint(theme.Dim, fmt.Sprintf("--- Session %s ---", v.session.title())))
+	for _, saved := range history {
+		exchange := chatExchange{
+			Response: ChatResponse{SentMessage: saved.Sent, ReplyMessage: saved.Reply},
+			Latency:  time.Duration(saved.LatencyMs) * time.Millisecond,
+		}
+		fmt.Printf("%s: %s\n", paint(theme.You, "You"), saved.Sent.Text)
+		v.render(exchange)
+		v.last = &exchange
+	}
+	fmt.Println(paint(theme.Dim, "--- Resumed ---"))
+	fmt.Println()
+}
+
+// render prints a Nomi's reply, word-wrapped and styled unless --raw is set.
+func (v *chatView) render(exchange chatExchange) {
+	meta, text := v.meta(exchange), exchange.Response.ReplyMessage.Text
+	if chatRaw {
+		fmt.Printf("%s%s: %s\n", meta, paint(theme.Nomi, v.nomi.Name), text)
+		return
+	}
+	fmt.Print(renderReply(meta, v.nomi.Name, theme.Nomi, text, outputWidth()))
+}
+
+// nameSession names the current session, for /name.
+func (v *chatView) nameSession(name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.session == nil {
+		fmt.Println("This session is not saved (--no-save).")
+		return
+	}
+	if name == "" {
+		fmt.Println("Usage: /name <name>")
+		return
+	}
+	if err := v.session.rename(name); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Session named %q.\n", name)
+}
+
+// listen records speech until the user presses Enter and returns the
+// transcript.
+func listen(speech *voice, reader *lineReader) (string, error) {
+	recording, err := speech.record()
+	if err != nil {
+		return "", err
+	}
+	reader.readLine(paint(theme.Error, "● ")+"Listening… press Enter to stop", 0)
+	fmt.Print(paint(theme.Info, "Transcribing…"))
+	transcript, err := recording.stop()
+	fmt.Print("\r\033[K")
+	return transcript, err
+}
+
+// openChatSession returns the session the chat command continues or starts,
+// following --resume and --session.
+func openChatSession(nomi Nomi) (*chatSession, error) {
+	sessions, err := loadSessions()
+	if err != nil {
+		return nil, fmt.Errorf("Error loading sessions: %v", err)
+	}
+
+	if chatSessionName != "" {
+		if session, err := findSession(sessions, chatSessionName); err == nil {
+			if session.NomiUUID != nomi.UUID {
+				return nil, fmt.Errorf("Error: session %q is with %s, not %s", chatSessionName, session.NomiName, nomi.Name)
+			}
+			return session, nil
+		}
+	} else if chatResume {
+		if session := latestSession(sessions, nomi.UUID); session != nil {
+			return session, nil
+		}
+	}
+
+	now := time.Now()
+	session := &chatSession{NomiUUID: nomi.UUID, NomiName: nomi.Name, Started: now, Updated: now}
+	if chatSessionName != "" {
+		if err := session.rename(chatSessionName); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// printInfo shows the IDs and times of the last exchange, to correlate it
+// with API logs or support tickets.
+func (v *chatView) printInfo() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.last == nil {
+		fmt.Println("No messages exchanged yet.")
+		return
+	}
+
+	response := v.last.Response
+	fmt.Println(paint(theme.Title, "Last exchange:"))
+	fmt.Printf("- Nomi: %s (%s)\n", v.nomi.Name, v.nomi.UUID)
+	fmt.Printf("- Sent message: %s at %s\n", response.SentMessage.UUID, parseAPITime(response.SentMessage.Sent).Local().Format(time.RFC3339))
+	fmt.Printf("- Reply message: %s at %s\n", response.ReplyMessage.UUID, parseAPITime(response.ReplyMessage.Sent).Local().Format(time.RFC3339))
+	if v.last.Latency > 0 {
+		fmt.Printf("- Latency: %s\n", formatLatency(v.last.Latency))
+	} else {
+		fmt.Println("- Latency: unknown (sent from another terminal)")
+	}
+}
+
 var chatCmd = &cobra.Command{
-	Use:   "chat [id]",
+	Use:   "chat [id|name]",
 	Short: "Start a live chat session with a specific Nomi",
-	Args:  cobra.ExactArgs(1), // Requires exactly one argument: the Nomi Name
+	Long: `Start a live chat session with a specific Nomi.
+
+The Nomi can be given as a full UUID, a unique UUID prefix, its name or part of its name.
+
+Replies are word-wrapped to the terminal width, with *actions*, **bold** and
+_emphasis_ styled and lists bulleted. Use --raw to print them as received.
+
+--timestamps shows when each reply was sent, in local time or, with
+--timestamps=relative, since the start of the session. --latency shows how
+long each reply took. Type /info to see the message IDs of the last exchange.
+
+Messages over the API's length limit are caught before sending, with a live
+character count shown as you type. --long-messages chooses what happens to
+them: ask (the default) offers to split or edit them, refuse drops them, split
+sends them as several messages on paragraph or sentence boundaries, waiting
+for each reply, and edit opens them in $VISUAL or $EDITOR to trim them.
+
+/file <path>, /run <command> and /clip attach a text file, the output of a
+shell command or the clipboard to the next message. Attachments are truncated
+to keep messages within the API's length limit, with a warning.
+
+Sessions are saved locally (see "sessions"). --resume continues the last
+session with the Nomi and --session continues or starts a named one, showing
+the last --history exchanges. Type /name <name> to name the session.
+
+--voice enables hands-free chat with local speech tools, set with --stt and
+--tts or "voice" in config.json. Press Enter on an empty line to start
+talking and Enter again to stop: the speech-to-text command records while its
+stdin is open, then prints the transcript. Replies are also read to the
+text-to-speech command's stdin. When a tool is missing or fails, chat falls
+back to text.`,
+	Args: cobra.ExactArgs(1), // Requires exactly one argument: the Nomi ID or name
 	Run: func(cmd *cobra.Command, args []string) {
 		// Ensure the screen is cleared when the program exits
 		defer clearScreen()
-		name := args[0]
 
-		// Find the UUID for the given name
-		nomiID, err := findNomiByName(name)
+		if chatTimestamps != "" && chatTimestamps != "absolute" && chatTimestamps != "relative" {
+			fmt.Printf("Error: --timestamps must be absolute or relative, not %q\n", chatTimestamps)
+			return
+		}
+
+		if chatLongMessages != longAsk && chatLongMessages != longRefuse && chatLongMessages != longSplit && chatLongMessages != longEdit {
+			fmt.Printf("Error: --long-messages must be ask, refuse, split or edit, not %q\n", chatLongMessages)
+			return
+		}
+
+		view := &chatView{start: time.Now()}
+		reader := newLineReader()
+
+		// Resolve the Nomi from its UUID, UUID prefix or name. When the daemon
+		// runs, messages other terminals exchange with this Nomi are shown too.
+		channel, err := openNomiChannel(args[0], func(exchange ChatResponse) {
+			reader.above(func() {
+				fmt.Printf("%s: %s\n", paint(theme.You, "You (other terminal)"), exchange.SentMessage.Text)
+				view.printReply(chatExchange{Response: exchange})
+			})
+		})
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
+		defer channel.Close()
+		view.nomi = channel.Nomi
+		name := channel.Nomi.Name
 
-		client := &http.Client{}
-		url := fmt.Sprintf("%s/nomis/%s/chat", baseURL, nomiID) // Use dynamic baseURL
+		if !chatNoSave {
+			view.session, err = openChatSession(channel.Nomi)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+
+		var speech *voice
+		var voiceWarnings strings.Builder
+		if chatVoice {
+			config, err := loadConfig()
+			if err != nil {
+				fmt.Println("Error loading config:", err)
+				return
+			}
+			var voiceConfig VoiceConfig
+			if config.Voice != nil {
+				voiceConfig = *config.Voice
+			}
+			if chatSTT != "" {
+				voiceConfig.STT = chatSTT
+			}
+			if chatTTS != "" {
+				voiceConfig.TTS = chatTTS
+			}
+			speech = newVoice(channel.Nomi, voiceConfig, &voiceWarnings)
+		}
 
 		// Clear the terminal at the start of the chat
 		clearScreen()
 
-		fmt.Printf("\n%s=== Chat Session with %s ===%s\n", colorYellow, name, colorReset)
-		fmt.Printf("%s• Type your message and press Enter to send\n", colorBlue)
-		fmt.Printf("• Type 'exit' to end the session%s\n\n", colorReset)
+		fmt.Printf("\n%s\n", paint(theme.Title, fmt.Sprintf("=== Chat Session with %s ===", name)))
+		fmt.Println(paint(theme.Info, "• Type your message and press Enter to send"))
+		if speech != nil && speech.stt != "" {
+			fmt.Println(paint(theme.Info, "• Press Enter on an empty line to talk, and Enter again to stop"))
+		}
+		fmt.Println(paint(theme.Info, "• Type '/file <path>', '/run <command>' or '/clip' to attach text to your next message"))
+		fmt.Println(paint(theme.Info, "• Type '/info' to show the IDs of the last exchange"))
+		fmt.Printf("%s\n\n", paint(theme.Info, "• Type 'exit' to end the session"))
+		fmt.Print(voiceWarnings.String())
+		if view.session != nil {
+			view.printHistory(chatHistory)
+		}
 
-		scanner := bufio.NewScanner(os.Stdin)
+		var attachments []attachment // Sent with the next message
 		for {
-			fmt.Printf("%sYou%s: ", colorGreen, colorReset)
-			if !scanner.Scan() {
+			input, ok := reader.readLine(paint(theme.You, "You")+": ", maxMessageLength)
+			if !ok {
 				break
 			}
-			input := scanner.Text()
 			if strings.ToLower(strings.TrimSpace(input)) == "exit" {
 				fmt.Println("Chat session ended.")
 				break
 			}
-
-			// Prepare the request payload
-			chatRequest := ChatRequest{MessageText: input}
-			requestBody, err := json.Marshal(chatRequest)
-			if err != nil {
-				fmt.Println("Error encoding request body:", err)
+			if strings.TrimSpace(input) == "/info" {
+				view.printInfo()
 				continue
 			}
-
-			// Create the HTTP request
-			req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-			if err != nil {
-				fmt.Println("Error creating request:", err)
+			if command, sessionName, _ := strings.Cut(strings.TrimSpace(input), " "); command == "/name" {
+				view.nameSession(strings.TrimSpace(sessionName))
+				continue
+			}
+			if directive, argument, _ := strings.Cut(strings.TrimSpace(input), " "); directive == "/file" || directive == "/run" || directive == "/clip" {
+				a, err := attachDirective(directive, strings.TrimSpace(argument))
+				if err != nil {
+					fmt.Println("Error attaching:", err)
+					continue
+				}
+				attachments = append(attachments, a)
+				length := len([]rune(a.Content))
+				fmt.Printf("Attached %s (%d characters), sent with your next message.\n", a.Label, length)
+				if length > maxMessageLength {
+					fmt.Println(paint(theme.Error, fmt.Sprintf("Warning: messages are limited to %d characters, so it will be truncated.", maxMessageLength)))
+				}
 				continue
 			}
-			req.Header.Set("Authorization", "Bearer "+apiKey)
-			req.Header.Set("Content-Type", "application/json")
+			// An empty line sends the pending attachments, or else listens
+			if input == "" && len(attachments) == 0 && speech != nil && speech.stt != "" {
+				transcript, err := listen(speech, reader)
+				if err != nil {
+					fmt.Printf("Voice input failed: %v. Type your message instead.\n", err)
+					continue
+				}
+				if transcript == "" {
+					fmt.Println("Nothing heard.")
+					continue
+				}
+				fmt.Printf("%s: %s\n", paint(theme.You, "You (voice)"), transcript)
+				input = transcript
+			}
 
-			// Start the spinner
-			stopChan := make(chan bool)
-			go spinner(stopChan)
+			if len(attachments) > 0 {
+				message, warnings := attachMessage(input, attachments)
+				for _, warning := range warnings {
+					fmt.Println(paint(theme.Error, "Warning: "+warning))
+				}
+				input, attachments = message, nil
+			}
 
-			// Send the request
-			resp, err := client.Do(req)
+			// Over-long messages are refused, split or edited before sending
+			messages := fitMessage(input, chatLongMessages, reader)
+			for i, message := range messages {
+				if len(messages) > 1 {
+					fmt.Println(paint(theme.Dim, fmt.Sprintf("Sending part %d of %d...", i+1, len(messages))))
+				}
 
-			// Stop the spinner
-			close(stopChan)
-			fmt.Print("\r") // Clear the spinner line
+				// Start the spinner
+				stopChan := make(chan bool)
+				go spinner(stopChan)
 
-			if err != nil {
-				fmt.Println("Error sending message:", err)
-				continue
-			}
-			defer resp.Body.Close()
+				// Send the message
+				start := time.Now()
+				chatResponse, err := channel.Send(message)
+				latency := time.Since(start)
 
-			// Check for successful response
-			if resp.StatusCode != http.StatusOK {
-				fmt.Printf("Error: %s\n", resp.Status)
-				continue
-			}
+				// Stop the spinner
+				close(stopChan)
+				fmt.Print("\r") // Clear the spinner line
 
-			// Decode the response
-			var chatResponse ChatResponse
-			if err := json.NewDecoder(resp.Body).Decode(&chatResponse); err != nil {
-				fmt.Println("Error decoding response:", err)
-				continue
-			}
+				if err != nil {
+					fmt.Println(err)
+					break
+				}
 
-			// Display the reply
-			fmt.Printf("%s%s%s: %s\n", colorBlue, name, colorReset, chatResponse.ReplyMessage.Text)
+				// Display the reply
+				view.printReply(chatExchange{Response: chatResponse, Latency: latency})
+				if speech != nil && speech.tts != "" {
+					if err := speech.speak(chatResponse.ReplyMessage.Text); err != nil {
+						fmt.Printf("Voice output failed: %v. Replies are shown as text only.\n", err)
+						speech.tts = ""
+					}
+				}
+			}
 		}
 	},
 }
+
+func init() {
+	chatCmd.Flags().BoolVar(&chatRaw, "raw", false, "Print replies as received, without wrapping or styling")
+	chatCmd.Flags().StringVar(&chatTimestamps, "timestamps", "", "Show when replies were sent: absolute (local time) or relative (to the session start)")
+	chatCmd.Flags().Lookup("timestamps").NoOptDefVal = "absolute"
+	chatCmd.Flags().BoolVar(&chatLatency, "latency", false, "Show how long each reply took")
+	chatCmd.Flags().BoolVar(&chatResume, "resume", false, "Continue the last session with this Nomi")
+	chatCmd.Flags().StringVar(&chatSessionName, "session", "", "Continue the session with this name, or start it")
+	chatCmd.Flags().IntVar(&chatHistory, "history", 10, "Number of past exchanges shown when continuing a session (0 for all)")
+	chatCmd.Flags().BoolVar(&chatNoSave, "no-save", false, "Don't save this session")
+	chatCmd.Flags().StringVar(&chatLongMessages, "long-messages", longAsk, "What to do with messages over the length limit: ask, refuse, split or edit")
+	chatCmd.Flags().BoolVar(&chatVoice, "voice", false, "Talk and listen with local speech-to-text and text-to-speech commands")
+	chatCmd.Flags().StringVar(&chatSTT, "stt", "", "Speech-to-text command for --voice: records until stdin closes, prints the transcript")
+	chatCmd.Flags().StringVar(&chatTTS, "tts", "", "Text-to-speech command for --voice: speaks the text read on stdin")
+}
@@ -3,12 +3,16 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestFindNomiByName(t *testing.T) {
+func TestResolveNomiByName(t *testing.T) {
 	// Create a test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Verify request headers
@@ -47,16 +51,16 @@ func TestFindNomiByName(t *testing.T) {
 	baseURL = server.URL
 
 	// Test finding existing Nomi
-	uuid, err := findNomiByName("John")
+	nomi, err := resolveNomi("John")
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
-	if uuid != "test-uuid-1" {
-		t.Errorf("Expected UUID test-uuid-1, got %s", uuid)
+	if nomi.UUID != "test-uuid-1" {
+		t.Errorf("Expected UUID test-uuid-1, got %s", nomi.UUID)
 	}
 
 	// Test finding non-existent Nomi
-	_, err = findNomiByName("NonExistent")
+	_, err = resolveNomi("NonExistent")
 	if err == nil {
 		t.Error("Expected error for non-existent Nomi, got none")
 	}
@@ -113,3 +117,74 @@ func TestChatRequest(t *testing.T) {
 		t.Errorf("Expected status OK, got %v", resp.Status)
 	}
 }
+
+func TestChatViewMeta(t *testing.T) {
+	defer func() { chatTimestamps, chatLatency = "", false }()
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	view := &chatView{start: start}
+	exchange := chatExchange{
+		Response: ChatResponse{ReplyMessage: Message{UUID: "msg-2", Sent: "2024-01-01T12:01:05Z"}},
+		Latency:  1234 * time.Millisecond,
+	}
+
+	if meta := view.meta(exchange); meta != "" {
+		t.Errorf("Expected no metadata by default, got %q", meta)
+	}
+
+	chatTimestamps, chatLatency = "relative", true
+	if meta := view.meta(exchange); meta != "[+1m5s · 1.2s] " {
+		t.Errorf("Unexpected relative metadata %q", meta)
+	}
+
+	chatTimestamps, chatLatency = "absolute", false
+	want := "[" + time.Date(2024, 1, 1, 12, 1, 5, 0, time.UTC).Local().Format("2006-01-02 15:04:05") + "] "
+	if meta := view.meta(exchange); meta != want {
+		t.Errorf("Expected %q, got %q", want, meta)
+	}
+}
+
+func TestChatViewInfo(t *testing.T) {
+	view := &chatView{nomi: Nomi{UUID: "nomi-123", Name: "Alice"}, start: time.Now()}
+
+	output := captureStdout(t, view.printInfo)
+	if !strings.Contains(output, "No messages exchanged yet.") {
+		t.Errorf("Expected no exchange yet, got %q", output)
+	}
+
+	exchange := chatExchange{
+		Response: ChatResponse{
+			SentMessage:  Message{UUID: "msg-1", Text: "Hi", Sent: "2024-01-01T12:00:00Z"},
+			ReplyMessage: Message{UUID: "msg-2", Text: "Hello!", Sent: "2024-01-01T12:00:01Z"},
+		},
+		Latency: 850 * time.Millisecond,
+	}
+	output = captureStdout(t, func() { view.printReply(exchange) })
+	if !strings.Contains(output, "Alice") || !strings.Contains(output, "Hello!") {
+		t.Errorf("Expected the reply to be printed, got %q", output)
+	}
+
+	output = captureStdout(t, view.printInfo)
+	for _, want := range []string{"- Nomi: Alice (nomi-123)", "- Sent message: msg-1", "- Reply message: msg-2", "- Latency: 850ms"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected /info to contain %q, got %q", want, output)
+		}
+	}
+}
+
+// captureStdout returns what f prints to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	oldStdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+
+	f()
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return string(out)
+}
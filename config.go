@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Config holds the user settings stored in config.json in the config
+// directory. The file is optional and may be edited by hand.
+type Config struct {
+	Webhooks []WebhookConfig `json:"webhooks,omitempty"`
+	Hooks    []HookConfig    `json:"hooks,omitempty"`
+
+	Theme  string                 `json:"theme,omitempty"`
+	Themes map[string]ThemeConfig `json:"themes,omitempty"`
+
+	Voice *VoiceConfig `json:"voice,omitempty"`
+}
+
+// loadConfig reads config.json, returning an empty Config if it is missing.
+func loadConfig() (Config, error) {
+	var config Config
+	path, err := configPath("config.json")
+	if err != nil {
+		return config, err
+	}
+	err = loadJSONFile(path, &config)
+	return config, err
+}
+
+// saveConfig writes config.json.
+func saveConfig(config Config) error {
+	path, err := configPath("config.json")
+	if err != nil {
+		return err
+	}
+	return saveJSONFile(path, config)
+}
+
+// configDir returns the directory holding nomi-cli's local files. It is
+// created on first write. NOMI_CONFIG_DIR overrides the platform default.
+func configDir() (string, error) {
+	dir := os.Getenv("NOMI_CONFIG_DIR")
+	if dir == "" {
+		base, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("error locating config directory: %v", err)
+		}
+		dir = filepath.Join(base, "nomi-cli")
+	}
+	return dir, nil
+}
+
+// configPath returns the path of a file in the config directory.
+func configPath(name string) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// ensureConfigPath creates the config directory and returns the path of name
+// in it, for files written by means other than saveJSONFile.
+func ensureConfigPath(name string) (string, error) {
+	path, err := configPath(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("error creating config directory: %v", err)
+	}
+	return path, nil
+}
+
+// loadJSONFile decodes the JSON file at path into v. A missing file leaves v
+// untouched and is not an error.
+func loadJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error decoding %s: %v", path, err)
+	}
+	return nil
+}
+
+// fileLockStale is how old a lock file must be to be taken as left behind by
+// a process that stopped while holding it.
+const fileLockStale = 10 * time.Second
+
+// lockFile takes a lock on path shared by all processes, by creating
+// path.lock, and returns the function releasing it. It waits while the lock
+// is held, for at most fileLockStale.
+func lockFile(path string) (func(), error) {
+	lock := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lock), 0700); err != nil {
+		return nil, err
+	}
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > fileLockStale {
+			os.Remove(lock)
+			continue
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// saveJSONFile atomically writes v as indented JSON to path, readable only by
+// the current user.
+func saveJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// converseTurn is one reply in a conversation between two Nomis.
+type converseTurn struct {
+	Number  int
+	Speaker Nomi
+	Reply   Message
+	Latency time.Duration
+}
+
+// conversation relays the replies of two Nomis to each other: the opener is
+// sent to the first, its reply to the second, and so on.
+type conversation struct {
+	channels   [2]*nomiChannel
+	turns      int    // Replies to collect in total
+	stopPhrase string // Ends the conversation when a reply contains it
+	onTurn     func(converseTurn)
+}
+
+// run holds the conversation until the turns are done, a Nomi says the stop
+// phrase or ctx is done, and returns why it ended.
+func (c *conversation) run(ctx context.Context, opener string) (string, error) {
+	text := opener
+	for turn := 1; turn <= c.turns; turn++ {
+		if ctx.Err() != nil {
+			return c.cancelled(ctx), nil
+		}
+		channel := c.channels[(turn-1)%2]
+
+		type result struct {
+			response ChatResponse
+			err      error
+		}
+		done := make(chan result, 1)
+		start := time.Now()
+		go func() {
+			response, err := channel.Send(text)
+			done <- result{response, err}
+		}()
+
+		var r result
+		select {
+		case r = <-done:
+		case <-ctx.Done():
+			return c.cancelled(ctx), nil
+		}
+		if r.err != nil {
+			return "", r.err
+		}
+
+		reply := r.response.ReplyMessage
+		c.onTurn(converseTurn{Number: turn, Speaker: channel.Nomi, Reply: reply, Latency: time.Since(start)})
+		if c.stopPhrase != "" && strings.Contains(strings.ToLower(reply.Text), strings.ToLower(c.stopPhrase)) {
+			return fmt.Sprintf("%s said the stop phrase", channel.Nomi.Name), nil
+		}
+		text = relayText(reply.Text)
+	}
+	return fmt.Sprintf("%d turns reached", c.turns), nil
+}
+
+// relayText returns the part of a reply relayed to the other Nomi. Replies
+// can be longer than the API accepts as a message; those are cut at the last
+// paragraph, sentence or word that fits.
+func relayText(reply string) string {
+	if messageLength(reply) <= maxMessageLength {
+		return reply
+	}
+	return splitMessage(reply, maxMessageLength)[0]
+}
+
+// cancelled explains why ctx ended the conversation.
+func (c *conversation) cancelled(ctx context.Context) string {
+	if ctx.Err() == context.DeadlineExceeded {
+		return "maximum duration reached"
+	}
+	return "interrupted"
+}
+
+// writeTranscriptTurn appends a reply to the transcript.
+func writeTranscriptTurn(w io.Writer, turn converseTurn) {
+	fmt.Fprintf(w, "[%s] %s: %s\n", parseAPITime(turn.Reply.Sent).Local().Format("2006-01-02 15:04:05"), turn.Speaker.Name, turn.Reply.Text)
+}
+
+var converseTurns int
+var converseOpener string
+var converseStopPhrase string
+var converseMaxDuration time.Duration
+var converseTranscript string
+
+var converseCmd = &cobra.Command{
+	Use:   "converse [first] [second]",
+	Short: "Let two Nomis talk to each other",
+	Long: `Let two Nomis talk to each other.
+
+The opener is sent to the first Nomi, its reply is sent to the second as its
+next message, the second's reply to the first, and so on for --turns replies.
+A reply over the 600-character message limit is cut to fit before it is
+relayed, at the end of a paragraph, sentence or word.
+The conversation ends early when a reply contains --stop-phrase (ignoring
+case), after --max-duration, or on Ctrl-C. --transcript writes the whole
+exchange to a file as it happens.
+
+Each Nomi can be given as a full UUID, a unique UUID prefix, its name or part
+of its name.`,
+	Example: `  nomi-cli converse Alice Bob --turns 10 --opener "Plan a weekend trip together"
+  nomi-cli converse Alice Bob --opener "Debate: cats or dogs?" --stop-phrase "agree" --max-duration 5m --transcript debate.txt`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if strings.TrimSpace(converseOpener) == "" {
+			fmt.Println("Error: an --opener is needed to start the conversation")
+			return
+		}
+		if converseTurns < 1 {
+			fmt.Println("Error: --turns must be at least 1")
+			return
+		}
+
+		var channels [2]*nomiChannel
+		for i, query := range args {
+			channel, err := openNomiChannel(query, nil)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			defer channel.Close()
+			channels[i] = channel
+		}
+		first, second := channels[0].Nomi, channels[1].Nomi
+		if first.UUID == second.UUID {
+			fmt.Println("Error: a Nomi can't converse with itself")
+			return
+		}
+
+		var transcript *os.File
+		if converseTranscript != "" {
+			var err error
+			transcript, err = os.OpenFile(converseTranscript, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+			if err != nil {
+				fmt.Println("Error creating transcript:", err)
+				return
+			}
+			defer transcript.Close()
+			fmt.Fprintf(transcript, "Conversation between %s and %s, started %s\n\n", first.Name, second.Name, time.Now().Format("2006-01-02 15:04:05"))
+			fmt.Fprintf(transcript, "Opener to %s: %s\n", first.Name, converseOpener)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if converseMaxDuration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, converseMaxDuration)
+			defer cancel()
+		}
+
+		colors := theme.nomiColors([]Nomi{first, second})
+		fmt.Println(paint(theme.Title, fmt.Sprintf("=== %s and %s ===", first.Name, second.Name)))
+		fmt.Printf("%s: %s\n", paint(theme.You, "You → "+first.Name), converseOpener)
+
+		c := &conversation{
+			channels:   channels,
+			turns:      converseTurns,
+			stopPhrase: converseStopPhrase,
+			onTurn: func(turn converseTurn) {
+				meta := fmt.Sprintf("[%d/%d · %s] ", turn.Number, converseTurns, formatLatency(turn.Latency))
+				fmt.Print(renderReply(meta, turn.Speaker.Name, colors[turn.Speaker.UUID], turn.Reply.Text, outputWidth()))
+				if transcript != nil {
+					writeTranscriptTurn(transcript, turn)
+				}
+			},
+		}
+		start := time.Now()
+		reason, err := c.run(ctx, converseOpener)
+		if err != nil {
+			fmt.Println(err)
+			reason = "error: " + err.Error()
+		}
+		ended := fmt.Sprintf("Conversation ended after %s: %s.", formatLatency(time.Since(start)), reason)
+		fmt.Println(paint(theme.Info, ended))
+		if transcript != nil {
+			fmt.Fprintf(transcript, "\n%s\n", ended)
+			fmt.Printf("Transcript written to %s.\n", converseTranscript)
+		}
+	},
+}
+
+func init() {
+	converseCmd.Flags().IntVar(&converseTurns, "turns", 10, "Number of replies, from both Nomis, before the conversation ends")
+	converseCmd.Flags().StringVar(&converseOpener, "opener", "", "Message sent to the first Nomi to start the conversation")
+	converseCmd.Flags().StringVar(&converseStopPhrase, "stop-phrase", "", "End the conversation when a reply contains this phrase")
+	converseCmd.Flags().DurationVar(&converseMaxDuration, "max-duration", 0, "End the conversation after this long, e.g. 5m (0 for no limit)")
+	converseCmd.Flags().StringVar(&converseTranscript, "transcript", "", "Write the conversation to this file")
+}
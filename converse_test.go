@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestChannels(t *testing.T, mock *mockServer) [2]*nomiChannel {
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	api := httptest.NewServer(mock.handler())
+	t.Cleanup(api.Close)
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	var channels [2]*nomiChannel
+	for i, query := range []string{"Alice", "Bob"} {
+		channel, err := openNomiChannel(query, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		channels[i] = channel
+	}
+	return channels
+}
+
+func TestConversationRelaysReplies(t *testing.T) {
+	channels := openTestChannels(t, newMockServer())
+
+	var turns []converseTurn
+	c := &conversation{channels: channels, turns: 3, onTurn: func(turn converseTurn) { turns = append(turns, turn) }}
+	reason, err := c.run(context.Background(), "Hello")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if reason != "3 turns reached" {
+		t.Errorf("Unexpected reason %q", reason)
+	}
+
+	want := []struct{ speaker, text string }{
+		{"Alice", "You said: Hello"},
+		{"Bob", "You said: You said: Hello"},
+		{"Alice", "You said: You said: You said: Hello"},
+	}
+	if len(turns) != len(want) {
+		t.Fatalf("Expected %d turns, got %d", len(want), len(turns))
+	}
+	for i, w := range want {
+		if turns[i].Number != i+1 || turns[i].Speaker.Name != w.speaker || turns[i].Reply.Text != w.text {
+			t.Errorf("Turn %d: expected %s: %q, got %+v", i+1, w.speaker, w.text, turns[i])
+		}
+	}
+}
+
+func TestConversationStops(t *testing.T) {
+	mock := newMockServer()
+	mock.replies["Bob"] = []string{"Nice to meet you", "Well, GOODBYE then"}
+	channels := openTestChannels(t, mock)
+
+	count := 0
+	c := &conversation{channels: channels, turns: 10, stopPhrase: "goodbye", onTurn: func(converseTurn) { count++ }}
+	reason, err := c.run(context.Background(), "Hello")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if reason != "Bob said the stop phrase" || count != 4 {
+		t.Errorf("Expected Bob to stop the conversation on turn 4, got %q after %d turns", reason, count)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	c = &conversation{channels: channels, turns: 10, onTurn: func(converseTurn) {}}
+	if reason, _ := c.run(ctx, "Hello"); reason != "maximum duration reached" {
+		t.Errorf("Expected the maximum duration to end the conversation, got %q", reason)
+	}
+}
+
+func TestConversationCutsLongReplies(t *testing.T) {
+	mock := newMockServer()
+	first := strings.Repeat("This sentence is here to fill the reply. ", 10)
+	mock.replies["Alice"] = []string{first + strings.Repeat("And then some more. ", 20)}
+	channels := openTestChannels(t, mock)
+
+	var turns []converseTurn
+	c := &conversation{channels: channels, turns: 2, onTurn: func(turn converseTurn) { turns = append(turns, turn) }}
+	if _, err := c.run(context.Background(), "Hello"); err != nil {
+		t.Fatalf("Expected the long reply to be relayed, got %v", err)
+	}
+	if len(turns) != 2 || messageLength(turns[0].Reply.Text) <= maxMessageLength {
+		t.Fatalf("Expected Alice's full reply over the limit, got %+v", turns)
+	}
+	relayed := strings.TrimPrefix(turns[1].Reply.Text, "You said: ")
+	if messageLength(relayed) > maxMessageLength || !strings.HasPrefix(relayed, strings.TrimSpace(first)) || !strings.HasSuffix(relayed, ".") {
+		t.Errorf("Expected Bob to get the reply cut after a sentence, got %q", relayed)
+	}
+}
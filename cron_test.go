@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Monday 2024-01-01 08:30
+	start := time.Date(2024, 1, 1, 8, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"0 9 * * 1-5", time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 8, 45, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2024, 1, 6, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 feb *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 8 * * 7", time.Date(2024, 1, 7, 8, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either may match
+		{"0 10 15 * 3", time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if next := schedule.next(start); !next.Equal(tt.expected) {
+				t.Errorf("Expected %s, got %s", tt.expected, next)
+			}
+		})
+	}
+}
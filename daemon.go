@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// The daemon speaks newline-delimited JSON over a Unix socket. A client sends
+// daemonRequests and reads daemonEvents; requests on one connection are
+// answered in order, while "exchange" events from other clients attached to
+// the same Nomi may arrive at any time.
+type daemonRequest struct {
+	Op   string `json:"op"` // status, stop, resolve, attach or send
+	Nomi string `json:"nomi,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+type daemonEvent struct {
+	Type     string        `json:"type"` // ok, error, status, nomi, reply or exchange
+	Error    string        `json:"error,omitempty"`
+	Nomi     *Nomi         `json:"nomi,omitempty"`
+	Exchange *ChatResponse `json:"exchange,omitempty"`
+	Status   *daemonStatus `json:"status,omitempty"`
+}
+
+type daemonStatus struct {
+	PID     int    `json:"pid"`
+	Started string `json:"started"`
+	Nomis   int    `json:"nomis"`
+	Clients int    `json:"clients"`
+	APIURL  string `json:"apiUrl"`
+	KeyHash string `json:"keyHash"` // See apiKeyHash
+}
+
+// apiKeyHash identifies an API key without revealing it, so that clients can
+// tell whether the daemon uses the same key as they would.
+func apiKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// nomiListTTL is how long the daemon trusts its cached Nomi list.
+const nomiListTTL = 5 * time.Minute
+
+func daemonSocketPath() (string, error) {
+	if path := os.Getenv("NOMI_DAEMON_SOCKET"); path != "" {
+		return path, nil
+	}
+	return configPath("daemon.sock")
+}
+
+// daemonConn is one client connection to the daemon.
+type daemonConn struct {
+	conn     net.Conn
+	mu       sync.Mutex
+	encoder  *json.Encoder
+	attached string // UUID of the Nomi the client watches
+}
+
+func (c *daemonConn) send(event daemonEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.encoder.Encode(event)
+}
+
+// chatDaemon owns API access for all attached clients.
+type chatDaemon struct {
+	listener net.Listener
+	started  time.Time
+	apiURL   string // API the daemon was started against
+	keyHash  string // apiKeyHash of the daemon's API key
+
+	mu       sync.Mutex
+	clients  map[*daemonConn]bool
+	nomis    []Nomi
+	fetched  time.Time
+	nomiLock map[string]*sync.Mutex // Serializes messages per Nomi UUID
+}
+
+func newChatDaemon(listener net.Listener) *chatDaemon {
+	return &chatDaemon{
+		listener: listener,
+		started:  time.Now(),
+		apiURL:   baseURL,
+		keyHash:  apiKeyHash(apiKey),
+		clients:  make(map[*daemonConn]bool),
+		nomiLock: make(map[string]*sync.Mutex),
+	}
+}
+
+// serve accepts clients until the listener is closed.
+func (d *chatDaemon) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+func (d *chatDaemon) handle(conn net.Conn) {
+	client := &daemonConn{conn: conn, encoder: json.NewEncoder(conn)}
+	d.mu.Lock()
+	d.clients[client] = true
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.clients, client)
+		d.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var request daemonRequest
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			client.send(daemonEvent{Type: "error", Error: "invalid request: " + err.Error()})
+			continue
+		}
+		if !d.dispatch(client, request) {
+			return
+		}
+	}
+}
+
+// dispatch handles one request and reports whether the daemon keeps running.
+func (d *chatDaemon) dispatch(client *daemonConn, request daemonRequest) bool {
+	switch request.Op {
+	case "status":
+		d.mu.Lock()
+		status := daemonStatus{
+			PID:     os.Getpid(),
+			Started: d.started.Format(time.RFC3339),
+			Nomis:   len(d.nomis),
+			Clients: len(d.clients),
+			APIURL:  d.apiURL,
+			KeyHash: d.keyHash,
+		}
+		d.mu.Unlock()
+		client.send(daemonEvent{Type: "status", Status: &status})
+	case "stop":
+		client.send(daemonEvent{Type: "ok"})
+		d.listener.Close()
+		return false
+	case "resolve":
+		nomi, err := d.resolve(request.Nomi)
+		if err != nil {
+			client.send(daemonEvent{Type: "error", Error: err.Error()})
+			return true
+		}
+		client.send(daemonEvent{Type: "nomi", Nomi: &nomi})
+	case "attach":
+		client.mu.Lock()
+		client.attached = request.Nomi
+		client.mu.Unlock()
+		client.send(daemonEvent{Type: "ok"})
+	case "send":
+		exchange, err := d.sendChat(request.Nomi, request.Text)
+		if err != nil {
+			client.send(daemonEvent{Type: "error", Error: err.Error()})
+			return true
+		}
+		client.send(daemonEvent{Type: "reply", Exchange: &exchange})
+		d.broadcast(client, request.Nomi, exchange)
+	default:
+		client.send(daemonEvent{Type: "error", Error: "unknown operation: " + request.Op})
+	}
+	return true
+}
+
+// resolve matches a query against the cached Nomi list, refreshing it when
+// stale or when nothing matches.
+func (d *chatDaemon) resolve(query string) (Nomi, error) {
+	d.mu.Lock()
+	nomis, fresh := d.nomis, time.Since(d.fetched) < nomiListTTL
+	d.mu.Unlock()
+
+	if fresh {
+		nomi, err := matchNomi(nomis, query)
+		if _, ambiguous := err.(*ambiguousError); err == nil || ambiguous {
+			return nomi, err
+		}
+	}
+
+	nomis, err := fetchNomis()
+	if err != nil {
+		return Nomi{}, err
+	}
+	d.mu.Lock()
+	d.nomis, d.fetched = nomis, time.Now()
+	d.mu.Unlock()
+	return matchNomi(nomis, query)
+}
+
+func (d *chatDaemon) sendChat(nomiID, text string) (ChatResponse, error) {
+	d.mu.Lock()
+	lock, ok := d.nomiLock[nomiID]
+	if !ok {
+		lock = &sync.Mutex{}
+		d.nomiLock[nomiID] = lock
+	}
+	nomi := Nomi{UUID: nomiID}
+	for _, cached := range d.nomis {
+		if cached.UUID == nomiID {
+			nomi = cached
+			break
+		}
+	}
+	d.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+	return sendChat(nomi, text)
+}
+
+// broadcast sends an exchange to every other client watching the Nomi.
+func (d *chatDaemon) broadcast(origin *daemonConn, nomiID string, exchange ChatResponse) {
+	d.mu.Lock()
+	var watchers []*daemonConn
+	for client := range d.clients {
+		client.mu.Lock()
+		if client != origin && client.attached == nomiID {
+			watchers = append(watchers, client)
+		}
+		client.mu.Unlock()
+	}
+	d.mu.Unlock()
+
+	for _, client := range watchers {
+		client.send(daemonEvent{Type: "exchange", Exchange: &exchange})
+	}
+}
+
+// daemonClient is a thin client connection to a running daemon.
+type daemonClient struct {
+	conn      net.Conn
+	encoder   *json.Encoder
+	responses chan daemonEvent
+	nomiID    string
+
+	mu         sync.Mutex
+	onExchange func(ChatResponse) // Set by attach while read is running
+}
+
+// dialDaemon connects to the daemon, returning an error if it isn't running.
+func dialDaemon() (*daemonClient, error) {
+	path, err := daemonSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &daemonClient{
+		conn:      conn,
+		encoder:   json.NewEncoder(conn),
+		responses: make(chan daemonEvent),
+	}
+	go client.read()
+	return client, nil
+}
+
+// read routes broadcast exchanges to onExchange and everything else to the
+// pending request.
+func (c *daemonClient) read() {
+	defer close(c.responses)
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event daemonEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		if event.Type == "exchange" {
+			c.mu.Lock()
+			onExchange := c.onExchange
+			c.mu.Unlock()
+			if onExchange != nil && event.Exchange != nil {
+				onExchange(*event.Exchange)
+			}
+			continue
+		}
+		c.responses <- event
+	}
+}
+
+func (c *daemonClient) request(request daemonRequest) (daemonEvent, error) {
+	if err := c.encoder.Encode(request); err != nil {
+		return daemonEvent{}, fmt.Errorf("error contacting daemon: %v", err)
+	}
+	event, ok := <-c.responses
+	if !ok {
+		return daemonEvent{}, fmt.Errorf("daemon closed the connection")
+	}
+	if event.Type == "error" {
+		return event, fmt.Errorf("%s", event.Error)
+	}
+	return event, nil
+}
+
+func (c *daemonClient) Close() error {
+	return c.conn.Close()
+}
+
+// status returns the daemon's status.
+func (c *daemonClient) status() (daemonStatus, error) {
+	event, err := c.request(daemonRequest{Op: "status"})
+	if err != nil {
+		return daemonStatus{}, err
+	}
+	return *event.Status, nil
+}
+
+func (c *daemonClient) resolve(query string) (Nomi, error) {
+	event, err := c.request(daemonRequest{Op: "resolve", Nomi: query})
+	if err != nil {
+		return Nomi{}, err
+	}
+	return *event.Nomi, nil
+}
+
+// attach subscribes to exchanges other clients have with the Nomi.
+func (c *daemonClient) attach(nomiID string, onExchange func(ChatResponse)) error {
+	c.mu.Lock()
+	c.onExchange = onExchange
+	c.mu.Unlock()
+	c.nomiID = nomiID
+	_, err := c.request(daemonRequest{Op: "attach", Nomi: nomiID})
+	return err
+}
+
+func (c *daemonClient) send(nomiID, text string) (ChatResponse, error) {
+	event, err := c.request(daemonRequest{Op: "send", Nomi: nomiID, Text: text})
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	return *event.Exchange, nil
+}
+
+// runDaemon listens on the socket until stopped.
+func runDaemon() error {
+	path, err := daemonSocketPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// Remove a socket left behind by a daemon that didn't exit cleanly
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("daemon already running on %s", path)
+	}
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %v", path, err)
+	}
+	defer os.Remove(path)
+	os.Chmod(path, 0600)
+
+	fmt.Printf("Daemon listening on %s (pid %d)\n", path, os.Getpid())
+	newChatDaemon(listener).serve()
+	fmt.Println("Daemon stopped.")
+	return nil
+}
+
+// daemonAPIKeyEnv is the environment variable "daemon start" hands the API
+// key to "daemon run" in.
+const daemonAPIKeyEnv = "NOMI_DAEMON_API_KEY"
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Manage the background chat daemon",
+	Long: `Manage the background chat daemon.
+
+While the daemon runs, "chat" and "send" connect to it over a Unix socket
+instead of calling the API themselves. The daemon caches the Nomi list and
+sends one message at a time per Nomi, and every terminal chatting with the same
+Nomi sees the whole conversation live.`,
+}
+
+var daemonStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the daemon in the background",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if client, err := dialDaemon(); err == nil {
+			client.Close()
+			fmt.Println("Daemon is already running.")
+			return
+		}
+
+		logPath, err := ensureConfigPath("daemon.log")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			fmt.Println("Error opening daemon log:", err)
+			return
+		}
+		defer logFile.Close()
+
+		executable, err := os.Executable()
+		if err != nil {
+			fmt.Println("Error locating nomi-cli executable:", err)
+			return
+		}
+
+		// The API key is handed over in the environment rather than with -k,
+		// so it never shows up in the process list.
+		child := exec.Command(executable, "daemon", "run")
+		child.Env = append(os.Environ(), "NOMI_API_URL="+baseURL, daemonAPIKeyEnv+"="+apiKey)
+		child.Stdout = logFile
+		child.Stderr = logFile
+		detachProcess(child)
+		if err := child.Start(); err != nil {
+			fmt.Println("Error starting daemon:", err)
+			return
+		}
+		pid := child.Process.Pid
+		go child.Wait()
+
+		for i := 0; i < 30; i++ {
+			if client, err := dialDaemon(); err == nil {
+				client.Close()
+				fmt.Printf("Daemon started (pid %d).\n", pid)
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		fmt.Printf("Daemon did not start, see %s\n", logPath)
+	},
+}
+
+var daemonRunCmd = &cobra.Command{
+	Use:         "run",
+	Short:       "Run the daemon in the foreground",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// "daemon start" passes the API key in the environment, which the
+		// hooks the daemon runs don't inherit.
+		if apiKey == "" {
+			apiKey = os.Getenv(daemonAPIKeyEnv)
+		}
+		os.Unsetenv(daemonAPIKeyEnv)
+		if apiKey == "" {
+			fmt.Println("API key not found. Please use the -k flag")
+			return
+		}
+		baseURL = os.Getenv("NOMI_API_URL")
+		if baseURL == "" {
+			baseURL = defaultAPIURL
+		}
+
+		if err := runDaemon(); err != nil {
+			fmt.Println("Error:", err)
+		}
+	},
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:         "stop",
+	Short:       "Stop the daemon",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := dialDaemon()
+		if err != nil {
+			fmt.Println("Daemon is not running.")
+			return
+		}
+		defer client.Close()
+		if _, err := client.request(daemonRequest{Op: "stop"}); err != nil {
+			fmt.Println("Error stopping daemon:", err)
+			return
+		}
+		fmt.Println("Daemon stopped.")
+	},
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:         "status",
+	Short:       "Show whether the daemon is running",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := dialDaemon()
+		if err != nil {
+			fmt.Println("Daemon is not running.")
+			return
+		}
+		defer client.Close()
+		event, err := client.request(daemonRequest{Op: "status"})
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		status := event.Status
+		fmt.Println("Daemon is running.")
+		fmt.Printf("- PID: %d\n- Started: %s\n- API: %s\n- Cached Nomis: %d\n- Clients: %d\n",
+			status.PID, status.Started, status.APIURL, status.Nomis, status.Clients-1) // Not counting this one
+	},
+}
+
+func init() {
+	daemonCmd.AddCommand(daemonStartCmd)
+	daemonCmd.AddCommand(daemonRunCmd)
+	daemonCmd.AddCommand(daemonStopCmd)
+	daemonCmd.AddCommand(daemonStatusCmd)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func startTestDaemon(t *testing.T) {
+	t.Helper()
+	api := httptest.NewServer(newMockServer().handler())
+	t.Cleanup(api.Close)
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	path := filepath.Join(t.TempDir(), "d.sock")
+	t.Setenv("NOMI_DAEMON_SOCKET", path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("Unix sockets unavailable: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go newChatDaemon(listener).serve()
+}
+
+func TestDaemonSharesConversation(t *testing.T) {
+	startTestDaemon(t)
+
+	exchanges := make(chan ChatResponse, 1)
+	watcher, err := openNomiChannel("alice", func(exchange ChatResponse) {
+		exchanges <- exchange
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer watcher.Close()
+	if watcher.daemon == nil {
+		t.Fatal("Expected the channel to go through the daemon")
+	}
+
+	sender, err := openNomiChannel("Alice", func(ChatResponse) {
+		t.Error("Expected the sender not to receive its own exchange")
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer sender.Close()
+
+	reply, err := sender.Send("Hello")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if reply.ReplyMessage.Text != "You said: Hello" {
+		t.Errorf("Unexpected reply: %+v", reply)
+	}
+
+	select {
+	case exchange := <-exchanges:
+		if exchange.SentMessage.Text != "Hello" || exchange.ReplyMessage.Text != "You said: Hello" {
+			t.Errorf("Unexpected exchange: %+v", exchange)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the watcher to receive the exchange")
+	}
+}
+
+func TestDaemonStatusAndErrors(t *testing.T) {
+	startTestDaemon(t)
+
+	client, err := dialDaemon()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.resolve("Zed"); err == nil {
+		t.Error("Expected error for unknown Nomi")
+	}
+
+	event, err := client.request(daemonRequest{Op: "status"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if event.Status.Nomis != 2 || event.Status.Clients != 1 {
+		t.Errorf("Unexpected status: %+v", event.Status)
+	}
+}
+
+func TestNomiChannelDaemonSettings(t *testing.T) {
+	startTestDaemon(t)
+	daemonURL := baseURL
+	defer func() { recordDir, traceFile = "", "" }()
+
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	tests := []struct {
+		name  string
+		setup func()
+	}{
+		{"another key", func() { apiKey = "other-api-key" }},
+		{"another API", func() { baseURL = api.URL }},
+		{"record", func() { recordDir = t.TempDir() }},
+		{"trace file", func() { traceFile = filepath.Join(t.TempDir(), "trace.har") }},
+	}
+	for _, test := range tests {
+		baseURL, apiKey, recordDir, traceFile = daemonURL, "test-api-key", "", ""
+		test.setup()
+		channel, err := openNomiChannel("alice", nil)
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", test.name, err)
+			continue
+		}
+		if channel.daemon != nil {
+			t.Errorf("%s: expected the daemon to be passed over", test.name)
+		}
+		channel.Close()
+	}
+}
+
+func TestNomiChannelWithoutDaemon(t *testing.T) {
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+
+	channel, err := openNomiChannel("bob", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer channel.Close()
+	if channel.daemon != nil {
+		t.Error("Expected a direct channel when the daemon isn't running")
+	}
+	if reply, err := channel.Send("Hi"); err != nil || reply.ReplyMessage.Text != "You said: Hi" {
+		t.Errorf("Unexpected reply %+v (%v)", reply, err)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var debugHTTP bool   // Log every API request and response to stderr
+var traceFile string // Write every API exchange to this file as HAR
+
+// newHTTPClient returns the HTTP client shared by all commands. Debug logging
+// and HAR tracing are layered on top of the API transport when enabled.
+func newHTTPClient() *http.Client {
+	transport, err := baseTransport()
+	if err != nil {
+		transport = failingTransport{err: err}
+	}
+	if debugHTTP || traceFile != "" {
+		transport = &debugTransport{next: transport, out: os.Stderr}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// envEnabled reports whether an environment variable is set to a truthy value.
+func envEnabled(name string) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(name))) {
+	case "", "0", "false", "no", "off":
+		return false
+	}
+	return true
+}
+
+// redactHeaders returns a copy of h with credentials masked.
+func redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	if auth := out.Get("Authorization"); auth != "" {
+		if strings.HasPrefix(auth, "Bearer ") {
+			out.Set("Authorization", "Bearer [REDACTED]")
+		} else {
+			out.Set("Authorization", "[REDACTED]")
+		}
+	}
+	return out
+}
+
+// debugTransport logs each request/response pair and records it for HAR output.
+type debugTransport struct {
+	next http.RoundTripper
+	out  io.Writer
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		reqBody, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	var respBody []byte
+	if err == nil {
+		respBody, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	}
+
+	if debugHTTP {
+		t.log(req, reqBody, resp, respBody, elapsed, err)
+	}
+	if traceFile != "" {
+		if werr := traceRecorder.add(traceFile, start, elapsed, req, reqBody, resp, respBody); werr != nil {
+			fmt.Fprintf(t.out, "[debug] error writing trace file: %v\n", werr)
+		}
+	}
+	return resp, err
+}
+
+func (t *debugTransport) log(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, elapsed time.Duration, err error) {
+	fmt.Fprintf(t.out, "[debug] --> %s %s\n", req.Method, req.URL)
+	writeHeaders(t.out, "[debug] >", redactHeaders(req.Header))
+	if len(reqBody) > 0 {
+		fmt.Fprintf(t.out, "[debug] > %s\n", reqBody)
+	}
+
+	if err != nil {
+		fmt.Fprintf(t.out, "[debug] <-- error after %s: %v\n", elapsed.Round(time.Millisecond), err)
+		return
+	}
+	fmt.Fprintf(t.out, "[debug] <-- %s (%s)\n", resp.Status, elapsed.Round(time.Millisecond))
+	writeHeaders(t.out, "[debug] <", resp.Header)
+	if len(respBody) > 0 {
+		fmt.Fprintf(t.out, "[debug] < %s\n", bytes.TrimSpace(respBody))
+	}
+}
+
+func writeHeaders(w io.Writer, prefix string, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s %s: %s\n", prefix, name, strings.Join(h[name], ", "))
+	}
+}
+
+// HAR 1.2 structures, limited to the fields nomi-cli fills in.
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harRecorder accumulates entries and rewrites the trace file after each one,
+// so the trace is complete even if the process is interrupted.
+type harRecorder struct {
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+var traceRecorder = &harRecorder{}
+
+func (r *harRecorder) add(path string, start time.Time, elapsed time.Duration, req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) error {
+	ms := float64(elapsed) / float64(time.Millisecond)
+	entry := harEntry{
+		StartedDateTime: start.Format(time.RFC3339Nano),
+		Time:            ms,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(redactHeaders(req.Header)),
+			QueryString: harQuery(req),
+			Cookies:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+		Response: harResponse{
+			Headers: []harNameValue{},
+			Cookies: []harNameValue{},
+			Content: harContent{
+				Size: len(respBody),
+				Text: string(respBody),
+			},
+			HeadersSize: -1,
+			BodySize:    len(respBody),
+		},
+		Timings: harTimings{Send: 0, Wait: ms, Receive: 0},
+	}
+	if entry.Request.HTTPVersion == "" {
+		entry.Request.HTTPVersion = "HTTP/1.1"
+	}
+	if len(reqBody) > 0 {
+		entry.Request.PostData = &harPostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     string(reqBody),
+		}
+	}
+	if resp != nil {
+		entry.Response.Status = resp.StatusCode
+		entry.Response.StatusText = strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode)))
+		entry.Response.HTTPVersion = resp.Proto
+		entry.Response.Headers = harHeaders(resp.Header)
+		entry.Response.Content.MimeType = resp.Header.Get("Content-Type")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+
+	data, err := json.MarshalIndent(harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "nomi-cli", Version: Version},
+		Entries: r.entries,
+	}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	out := []harNameValue{}
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range h[name] {
+			out = append(out, harNameValue{Name: name, Value: value})
+		}
+	}
+	return out
+}
+
+func harQuery(req *http.Request) []harNameValue {
+	out := []harNameValue{}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			out = append(out, harNameValue{Name: name, Value: value})
+		}
+	}
+	return out
+}
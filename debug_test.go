@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugTransportRedactsAuthorization(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The real token must still reach the server
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			t.Errorf("Expected real Authorization header, got %q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"nomis":[]}`))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	originalDebug := debugHTTP
+	debugHTTP = true
+	defer func() { debugHTTP = originalDebug }()
+
+	client := &http.Client{Transport: &debugTransport{next: http.DefaultTransport, out: &out}}
+	req, _ := http.NewRequest("GET", server.URL+"/nomis", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+
+	log := out.String()
+	if strings.Contains(log, "secret-token") {
+		t.Errorf("Expected token to be redacted, got %q", log)
+	}
+	for _, expected := range []string{
+		"--> GET " + server.URL + "/nomis",
+		"Authorization: Bearer [REDACTED]",
+		"<-- 200 OK",
+		`{"nomis":[]}`,
+	} {
+		if !strings.Contains(log, expected) {
+			t.Errorf("Expected %q in debug log, got %q", expected, log)
+		}
+	}
+}
+
+func TestTraceFileWritesHAR(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"replyMessage":{"text":"hi"}}`))
+	}))
+	defer server.Close()
+
+	originalTrace, originalRecorder := traceFile, traceRecorder
+	traceFile = filepath.Join(t.TempDir(), "trace.har")
+	traceRecorder = &harRecorder{}
+	defer func() { traceFile, traceRecorder = originalTrace, originalRecorder }()
+
+	client := newHTTPClient()
+	req, _ := http.NewRequest("POST", server.URL+"/nomis/id/chat", strings.NewReader(`{"messageText":"hello"}`))
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+
+	data, err := os.ReadFile(traceFile)
+	if err != nil {
+		t.Fatalf("Expected trace file, got %v", err)
+	}
+	if bytes.Contains(data, []byte("secret-token")) {
+		t.Error("Expected token to be redacted from the HAR file")
+	}
+
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("Error decoding HAR: %v", err)
+	}
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(har.Log.Entries))
+	}
+	entry := har.Log.Entries[0]
+	if entry.Request.Method != "POST" || entry.Request.PostData == nil || entry.Request.PostData.Text != `{"messageText":"hello"}` {
+		t.Errorf("Unexpected request entry: %+v", entry.Request)
+	}
+	if entry.Response.Status != 200 || entry.Response.Content.Text != `{"replyMessage":{"text":"hi"}}` {
+		t.Errorf("Unexpected response entry: %+v", entry.Response)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gatewayToken is a locally issued credential for the REST gateway. Only the
+// SHA-256 hash of the secret is stored.
+type gatewayToken struct {
+	Name       string   `json:"name"`
+	Hash       string   `json:"hash"`
+	AllowNomis []string `json:"allowNomis,omitempty"` // Nomi UUIDs; empty allows all
+	Created    string   `json:"created"`
+}
+
+// allows reports whether the token may access the Nomi with the given UUID.
+func (t gatewayToken) allows(uuid string) bool {
+	if len(t.AllowNomis) == 0 {
+		return true
+	}
+	for _, allowed := range t.AllowNomis {
+		if allowed == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+type gatewayTokenFile struct {
+	Tokens []gatewayToken `json:"tokens"`
+}
+
+func gatewayTokensPath() (string, error) {
+	return configPath("gateway-tokens.json")
+}
+
+func loadGatewayTokens() ([]gatewayToken, error) {
+	path, err := gatewayTokensPath()
+	if err != nil {
+		return nil, err
+	}
+	var file gatewayTokenFile
+	if err := loadJSONFile(path, &file); err != nil {
+		return nil, err
+	}
+	return file.Tokens, nil
+}
+
+func saveGatewayTokens(tokens []gatewayToken) error {
+	path, err := gatewayTokensPath()
+	if err != nil {
+		return err
+	}
+	return saveJSONFile(path, gatewayTokenFile{Tokens: tokens})
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueGatewayToken creates a token and returns it with its secret, which is
+// shown once and never stored.
+func issueGatewayToken(name string, allowNomis []string) (gatewayToken, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return gatewayToken{}, "", err
+	}
+	secret := "nomi_gw_" + hex.EncodeToString(b)
+	return gatewayToken{
+		Name:       name,
+		Hash:       hashToken(secret),
+		AllowNomis: allowNomis,
+		Created:    time.Now().UTC().Format(time.RFC3339),
+	}, secret, nil
+}
+
+// gateway is a local HTTP API mirroring the CLI commands. Callers
+// authenticate with gateway tokens; requests are forwarded to baseURL with
+// the stored API key.
+type gateway struct {
+	tokens []gatewayToken
+	log    io.Writer
+	logMu  sync.Mutex
+}
+
+type gatewayTokenKey struct{}
+
+func withGatewayToken(ctx context.Context, token gatewayToken) context.Context {
+	return context.WithValue(ctx, gatewayTokenKey{}, token)
+}
+
+func gatewayTokenFrom(ctx context.Context) gatewayToken {
+	token, _ := ctx.Value(gatewayTokenKey{}).(gatewayToken)
+	return token
+}
+
+func (g *gateway) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /nomis", g.handleListNomis)
+	mux.HandleFunc("GET /nomis/{id}", g.handleGetNomi)
+	mux.HandleFunc("POST /nomis/{id}/chat", g.handleChat)
+	mux.HandleFunc("GET /rooms", g.handleListRooms)
+	return g.authenticated(mux, func(w http.ResponseWriter) {
+		writeAPIError(w, http.StatusUnauthorized, "InvalidToken")
+	})
+}
+
+// authenticated serves next to callers with a valid token, which handlers
+// get with gatewayTokenFrom, and answers others with reject. Every request
+// is logged.
+func (g *gateway) authenticated(next http.Handler, reject func(http.ResponseWriter)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		token, ok := g.authenticate(r)
+		name := "-"
+		if ok {
+			name = token.Name
+			next.ServeHTTP(recorder, r.WithContext(withGatewayToken(r.Context(), token)))
+		} else {
+			reject(recorder)
+		}
+
+		g.logMu.Lock()
+		fmt.Fprintf(g.log, "%s %s %s %s %s %d %s\n",
+			start.Format(time.RFC3339), r.RemoteAddr, name, r.Method, r.URL.Path,
+			recorder.status, time.Since(start).Round(time.Millisecond))
+		g.logMu.Unlock()
+	})
+}
+
+func (g *gateway) authenticate(r *http.Request) (gatewayToken, bool) {
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || secret == "" {
+		return gatewayToken{}, false
+	}
+	hash := hashToken(secret)
+	for _, token := range g.tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hash)) == 1 {
+			return token, true
+		}
+	}
+	return gatewayToken{}, false
+}
+
+func (g *gateway) handleListNomis(w http.ResponseWriter, r *http.Request) {
+	token := gatewayTokenFrom(r.Context())
+	nomis, err := fetchNomis()
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	allowed := []Nomi{}
+	for _, nomi := range nomis {
+		if token.allows(nomi.UUID) {
+			allowed = append(allowed, nomi)
+		}
+	}
+	writeJSON(w, NomiResponse{Nomis: allowed})
+}
+
+// resolveAllowed resolves the {id} path value like the CLI does and checks
+// the caller may use it. Forbidden Nomis are reported as not found.
+func (g *gateway) resolveAllowed(w http.ResponseWriter, r *http.Request) (Nomi, bool) {
+	token := gatewayTokenFrom(r.Context())
+	nomi, err := resolveNomi(r.PathValue("id"))
+	if err != nil {
+		if _, ok := err.(*statusError); ok {
+			writeUpstreamError(w, err)
+		} else {
+			writeAPIError(w, http.StatusNotFound, "NomiNotFound")
+		}
+		return Nomi{}, false
+	}
+	if !token.allows(nomi.UUID) {
+		writeAPIError(w, http.StatusNotFound, "NomiNotFound")
+		return Nomi{}, false
+	}
+	return nomi, true
+}
+
+func (g *gateway) handleGetNomi(w http.ResponseWriter, r *http.Request) {
+	if nomi, ok := g.resolveAllowed(w, r); ok {
+		writeJSON(w, nomi)
+	}
+}
+
+func (g *gateway) handleChat(w http.ResponseWriter, r *http.Request) {
+	var chatRequest ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&chatRequest); err != nil || chatRequest.MessageText == "" {
+		writeAPIError(w, http.StatusBadRequest, "InvalidBody")
+		return
+	}
+	nomi, ok := g.resolveAllowed(w, r)
+	if !ok {
+		return
+	}
+	chatResponse, err := sendChat(nomi, chatRequest.MessageText)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, chatResponse)
+}
+
+// handleListRooms only lists rooms whose Nomis are all allowed for the caller.
+func (g *gateway) handleListRooms(w http.ResponseWriter, r *http.Request) {
+	token := gatewayTokenFrom(r.Context())
+	rooms, err := fetchRooms()
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	allowed := []Room{}
+	for _, room := range rooms {
+		visible := true
+		for _, nomi := range room.Nomis {
+			if !token.allows(nomi.UUID) {
+				visible = false
+				break
+			}
+		}
+		if visible {
+			allowed = append(allowed, room)
+		}
+	}
+	writeJSON(w, RoomResponse{Rooms: allowed})
+}
+
+// writeUpstreamError relays a Nomi API failure to the caller.
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	if statusErr, ok := err.(*statusError); ok {
+		var code int
+		fmt.Sscanf(statusErr.Status, "%d", &code)
+		if code >= 400 {
+			writeAPIError(w, code, "UpstreamError")
+			return
+		}
+	}
+	writeAPIError(w, http.StatusBadGateway, "UpstreamUnavailable")
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gatewayRequest(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return resp
+}
+
+func TestGatewayTokensAndAccess(t *testing.T) {
+	mock := newMockServer()
+	api := httptest.NewServer(mock.handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "real-api-key"
+
+	alice, bob := mock.nomis[0], mock.nomis[1]
+	full, fullSecret, _ := issueGatewayToken("full", nil)
+	limited, limitedSecret, _ := issueGatewayToken("limited", []string{alice.UUID})
+
+	var log bytes.Buffer
+	gw := &gateway{tokens: []gatewayToken{full, limited}, log: &log}
+	server := httptest.NewServer(gw.handler())
+	defer server.Close()
+
+	// Unknown tokens and the real API key are rejected
+	for _, token := range []string{"", "nomi_gw_wrong", "real-api-key"} {
+		resp := gatewayRequest(t, "GET", server.URL+"/nomis", token, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for token %q, got %s", token, resp.Status)
+		}
+	}
+
+	// Tokens only see their allowed Nomis
+	for token, expected := range map[string]int{fullSecret: 2, limitedSecret: 1} {
+		resp := gatewayRequest(t, "GET", server.URL+"/nomis", token, "")
+		var result NomiResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if len(result.Nomis) != expected {
+			t.Errorf("Expected %d Nomis, got %d", expected, len(result.Nomis))
+		}
+	}
+
+	// Nomis can be designated by name, and forbidden ones look missing
+	resp := gatewayRequest(t, "POST", server.URL+"/nomis/alice/chat", limitedSecret, `{"messageText":"Hi"}`)
+	var chat ChatResponse
+	json.NewDecoder(resp.Body).Decode(&chat)
+	resp.Body.Close()
+	if chat.ReplyMessage.Text != "You said: Hi" {
+		t.Errorf("Unexpected reply: %+v", chat)
+	}
+
+	resp = gatewayRequest(t, "GET", server.URL+"/nomis/"+bob.UUID, limitedSecret, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for forbidden Nomi, got %s", resp.Status)
+	}
+
+	// The sample room contains Bob, so it is hidden from the limited token
+	resp = gatewayRequest(t, "GET", server.URL+"/rooms", limitedSecret, "")
+	var rooms RoomResponse
+	json.NewDecoder(resp.Body).Decode(&rooms)
+	resp.Body.Close()
+	if len(rooms.Rooms) != 0 {
+		t.Errorf("Expected no visible rooms, got %d", len(rooms.Rooms))
+	}
+
+	// Every request is logged with the token name, never the secret
+	logged := log.String()
+	if !strings.Contains(logged, " limited POST /nomis/alice/chat 200 ") {
+		t.Errorf("Expected access log entry, got %q", logged)
+	}
+	if strings.Contains(logged, limitedSecret) {
+		t.Error("Expected secrets to stay out of the access log")
+	}
+}
+
+func TestGatewayTokenStore(t *testing.T) {
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+
+	token, secret, err := issueGatewayToken("svc", []string{"uuid-1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := saveGatewayTokens([]gatewayToken{token}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	tokens, err := loadGatewayTokens()
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("Expected 1 token, got %d (%v)", len(tokens), err)
+	}
+	if tokens[0].Hash != hashToken(secret) || strings.Contains(tokens[0].Hash, secret) {
+		t.Error("Expected only the token hash to be stored")
+	}
+	if !tokens[0].allows("uuid-1") || tokens[0].allows("uuid-2") {
+		t.Error("Expected token to be limited to uuid-1")
+	}
+}
@@ -1,56 +1,40 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
 
 	"github.com/spf13/cobra"
 )
 
 var getNomiCmd = &cobra.Command{
-	Use:   "get-nomi [id]",
+	Use:   "get-nomi [id|name]",
 	Short: "Get details of a specific Nomi",
-	Args:  cobra.ExactArgs(1), // Ensure exactly one argument is passed (the Nomi ID)
-	Run: func(cmd *cobra.Command, args []string) {
-		id := args[0]
-		client := &http.Client{}
-		url := fmt.Sprintf("%s/nomis/%s", baseURL, id) // Use dynamic baseURL
-
-		// Create the request
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			fmt.Println("Error creating request:", err)
-			return
-		}
-
-		// Set the Authorization header
-		req.Header.Set("Authorization", "Bearer "+apiKey)
+	Long: `Get details of a specific Nomi.
 
-		// Perform the request
-		resp, err := client.Do(req)
+The Nomi can be given as a full UUID, a unique UUID prefix, its name or part of its name.`,
+	Args: cobra.ExactArgs(1), // Ensure exactly one argument is passed (the Nomi ID or name)
+	Run: func(cmd *cobra.Command, args []string) {
+		nomi, err := resolveNomi(args[0])
 		if err != nil {
-			fmt.Println("Error making request:", err)
-			return
-		}
-		defer resp.Body.Close()
-
-		// Check the response status
-		if resp.StatusCode != http.StatusOK {
-			fmt.Printf("Error: %s\n", resp.Status)
-			return
-		}
-
-		// Parse the response body
-		var nomi Nomi
-		if err := json.NewDecoder(resp.Body).Decode(&nomi); err != nil {
-			fmt.Println("Error decoding response:", err)
+			fmt.Println(err)
 			return
 		}
 
 		// Print the Nomi details
-		fmt.Println("Nomi Details:")
-		fmt.Printf("- ID: %s\n- Name: %s\n- Gender: %s\n- Created: %s\n- Relationship Type: %s\n",
-			nomi.UUID, nomi.Name, nomi.Gender, nomi.Created, nomi.RelationshipType)
+		for _, line := range nomiDetails(nomi) {
+			fmt.Println(line)
+		}
 	},
 }
+
+// nomiDetails returns the lines describing a Nomi, as get-nomi prints them.
+func nomiDetails(nomi Nomi) []string {
+	return []string{
+		"Nomi Details:",
+		fmt.Sprintf("- ID: %s", nomi.UUID),
+		fmt.Sprintf("- Name: %s", nomi.Name),
+		fmt.Sprintf("- Gender: %s", nomi.Gender),
+		fmt.Sprintf("- Created: %s", nomi.Created),
+		fmt.Sprintf("- Relationship Type: %s", nomi.RelationshipType),
+	}
+}
@@ -32,6 +32,12 @@ func TestGetNomiCmdSuccess(t *testing.T) {
 			return
 		}
 
+		if r.Method == "GET" && r.URL.Path == "/nomis" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(NomiResponse{Nomis: []Nomi{testNomi}})
+			return
+		}
+
 		if r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/nomis/") {
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(testNomi)
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Hook stages: send hooks see outgoing messages, reply hooks see replies.
+const (
+	hookSend  = "send"
+	hookReply = "reply"
+)
+
+// hookTimeout bounds how long a hook may run for a single message.
+const hookTimeout = 30 * time.Second
+
+// HookConfig is a shell command that rewrites messages. It reads the text on
+// stdin and writes the new text on stdout; a send hook exiting with a non-zero
+// status vetoes the message.
+type HookConfig struct {
+	Stage   string `json:"stage"`
+	Command string `json:"command"`
+}
+
+// vetoError reports an outgoing message rejected by a send hook.
+type vetoError struct {
+	Command string
+	Reason  string
+}
+
+func (e *vetoError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("Message vetoed by hook %q", e.Command)
+	}
+	return fmt.Sprintf("Message vetoed by hook %q: %s", e.Command, e.Reason)
+}
+
+// shellCommand returns a command running line with the platform shell.
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", line)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
+
+// runHooks passes text through every hook of the given stage, in order. The
+// Nomi is described to hooks by NOMI_UUID and NOMI_NAME.
+func runHooks(hooks []HookConfig, stage string, nomi Nomi, text string) (string, error) {
+	for _, hook := range hooks {
+		if hook.Stage != stage {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+		cmd := shellCommand(ctx, hook.Command)
+		cmd.Env = append(os.Environ(),
+			"NOMI_HOOK_STAGE="+stage,
+			"NOMI_UUID="+nomi.UUID,
+			"NOMI_NAME="+nomi.Name,
+		)
+		cmd.Stdin = strings.NewReader(text)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		timedOut := ctx.Err() != nil
+		cancel()
+
+		reason := strings.TrimSpace(stderr.String())
+		if err != nil {
+			if _, exited := err.(*exec.ExitError); exited && stage == hookSend && !timedOut {
+				return "", &vetoError{Command: hook.Command, Reason: reason}
+			}
+			if reason != "" {
+				err = fmt.Errorf("%v: %s", err, reason)
+			}
+			return "", fmt.Errorf("error running %s hook %q: %v", stage, hook.Command, err)
+		}
+
+		text = strings.TrimSuffix(strings.TrimSuffix(stdout.String(), "\n"), "\r")
+		if text == "" && stage == hookSend {
+			return "", &vetoError{Command: hook.Command, Reason: "empty message"}
+		}
+	}
+	return text, nil
+}
+
+var hookCmd = &cobra.Command{
+	Use:   "hook",
+	Short: "Manage hooks rewriting messages and replies",
+	Long: `Manage hooks rewriting messages and replies.
+
+A hook is a shell command run for every message sent by any command (chat,
+send, the daemon, the servers and the bridges). It reads the text on stdin
+and writes the text to use instead on stdout. Hooks of a stage run in the
+order they were added, each one receiving the output of the previous one.
+
+  send   runs on each outgoing message. Exiting with a non-zero status, or
+         printing nothing, vetoes the message; stderr is shown as the reason.
+  reply  runs on each reply. If it fails, a warning is printed on stderr
+         and the reply is shown unchanged.
+
+Hooks get NOMI_HOOK_STAGE, NOMI_UUID and NOMI_NAME in their environment.`,
+}
+
+var hookAddCmd = &cobra.Command{
+	Use:         "add [send|reply] [command]",
+	Short:       "Add a hook",
+	Args:        cobra.ExactArgs(2),
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		stage := args[0]
+		if stage != hookSend && stage != hookReply {
+			fmt.Printf("Error: unknown hook stage %q, expected send or reply\n", stage)
+			return
+		}
+		config, err := loadConfig()
+		if err != nil {
+			fmt.Println("Error loading config:", err)
+			return
+		}
+		config.Hooks = append(config.Hooks, HookConfig{Stage: stage, Command: args[1]})
+		if err := saveConfig(config); err != nil {
+			fmt.Println("Error saving config:", err)
+			return
+		}
+		fmt.Printf("Hook %d added.\n", len(config.Hooks))
+	},
+}
+
+var hookListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List hooks",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig()
+		if err != nil {
+			fmt.Println("Error loading config:", err)
+			return
+		}
+		if len(config.Hooks) == 0 {
+			fmt.Println("No hooks configured.")
+			return
+		}
+		for i, hook := range config.Hooks {
+			fmt.Printf("%d. [%s] %s\n", i+1, hook.Stage, hook.Command)
+		}
+	},
+}
+
+var hookRemoveCmd = &cobra.Command{
+	Use:         "remove [number]",
+	Short:       "Remove a hook by its number in hook list",
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig()
+		if err != nil {
+			fmt.Println("Error loading config:", err)
+			return
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > len(config.Hooks) {
+			fmt.Printf("Error: no hook %s\n", args[0])
+			return
+		}
+		config.Hooks = append(config.Hooks[:n-1], config.Hooks[n:]...)
+		if err := saveConfig(config); err != nil {
+			fmt.Println("Error saving config:", err)
+			return
+		}
+		fmt.Printf("Hook %d removed.\n", n)
+	},
+}
+
+func init() {
+	hookCmd.AddCommand(hookAddCmd)
+	hookCmd.AddCommand(hookListCmd)
+	hookCmd.AddCommand(hookRemoveCmd)
+}
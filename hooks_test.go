@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are sh commands in this test")
+	}
+	nomi := Nomi{UUID: "nomi-123", Name: "Alice"}
+
+	tests := []struct {
+		name  string
+		hooks []HookConfig
+		stage string
+		want  string
+		veto  string
+	}{
+		{
+			name:  "No hooks",
+			stage: hookSend,
+			want:  "hello",
+		},
+		{
+			name: "Hooks are chained in order",
+			hooks: []HookConfig{
+				{Stage: hookSend, Command: `sed 's/^/[ctx] /'`},
+				{Stage: hookReply, Command: "tr a-z A-Z"},
+				{Stage: hookSend, Command: `sed "s/$/ ($NOMI_NAME)/"`},
+			},
+			stage: hookSend,
+			want:  "[ctx] hello (Alice)",
+		},
+		{
+			name:  "Reply stage",
+			hooks: []HookConfig{{Stage: hookReply, Command: "tr a-z A-Z"}},
+			stage: hookReply,
+			want:  "HELLO",
+		},
+		{
+			name:  "Non-zero exit vetoes",
+			hooks: []HookConfig{{Stage: hookSend, Command: "echo contains PII >&2; exit 1"}},
+			stage: hookSend,
+			veto:  "contains PII",
+		},
+		{
+			name:  "Empty output vetoes",
+			hooks: []HookConfig{{Stage: hookSend, Command: "cat >/dev/null"}},
+			stage: hookSend,
+			veto:  "empty message",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runHooks(tt.hooks, tt.stage, nomi, "hello")
+			if tt.veto != "" {
+				var veto *vetoError
+				if !errors.As(err, &veto) || veto.Reason != tt.veto {
+					t.Fatalf("Expected a veto with reason %q, got %v", tt.veto, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRunHooksReplyFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are sh commands in this test")
+	}
+	_, err := runHooks([]HookConfig{{Stage: hookReply, Command: "exit 2"}}, hookReply, Nomi{}, "hello")
+	if err == nil || !strings.Contains(err.Error(), "error running reply hook") {
+		t.Errorf("Expected a reply hook error, got %v", err)
+	}
+}
+
+func TestSendChatRunsHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are sh commands in this test")
+	}
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	err := saveConfig(Config{Hooks: []HookConfig{
+		{Stage: hookSend, Command: `grep -v secret || { echo "no secrets" >&2; exit 1; }`},
+		{Stage: hookReply, Command: "sed 's/You said/Echo/'"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nomi := Nomi{UUID: "6a3e8f5c-2b4d-4e6f-8a1b-3c5d7e9f0a21", Name: "Alice"}
+
+	chatResponse, err := sendChat(nomi, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatResponse.ReplyMessage.Text != "Echo: hello" {
+		t.Errorf("Expected the reply hook to rewrite the reply, got %q", chatResponse.ReplyMessage.Text)
+	}
+
+	_, err = sendChat(nomi, "my secret")
+	if err == nil || err.Error() != `Message vetoed by hook "grep -v secret || { echo \"no secrets\" >&2; exit 1; }": no secrets` {
+		t.Errorf("Expected the message to be vetoed, got %v", err)
+	}
+}
+
+func TestSendChatHookFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are sh commands in this test")
+	}
+	dir := t.TempDir()
+	t.Setenv("NOMI_CONFIG_DIR", dir)
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	payloads := make(chan webhookPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- payload
+	}))
+	defer receiver.Close()
+	err := saveConfig(Config{
+		Hooks:    []HookConfig{{Stage: hookReply, Command: "exit 2"}},
+		Webhooks: []WebhookConfig{{URL: receiver.URL}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nomi := Nomi{UUID: "6a3e8f5c-2b4d-4e6f-8a1b-3c5d7e9f0a21", Name: "Alice"}
+
+	// A failing reply hook keeps the reply and still notifies webhooks
+	chatResponse, err := sendChat(nomi, "hello")
+	if err != nil || chatResponse.ReplyMessage.Text != "You said: hello" {
+		t.Errorf("Expected the unchanged reply, got %q (%v)", chatResponse.ReplyMessage.Text, err)
+	}
+	select {
+	case payload := <-payloads:
+		if payload.ReplyMessage.Text != "You said: hello" {
+			t.Errorf("Unexpected payload: %+v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected a webhook delivery")
+	}
+	webhookDeliveries.Wait()
+
+	// A broken config could hide send hooks, so nothing is sent
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte("{"), 0600)
+	if _, err := sendChat(nomi, "again"); err == nil || !strings.Contains(err.Error(), "error loading config") {
+		t.Errorf("Expected the message not to be sent, got %v", err)
+	}
+}
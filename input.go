@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+)
+
+// ansiPattern matches the escape sequences styling terminal output.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+
+// lineReader reads chat input. On a terminal it reads key presses itself, to
+// show a live count of the characters typed against a limit; otherwise it
+// reads lines as they come.
+type lineReader struct {
+	in      io.Reader
+	out     io.Writer
+	scanner *bufio.Scanner
+	live    bool                   // Read key presses rather than lines
+	keyMode func() (func(), error) // Switches the terminal to key mode
+
+	mu      sync.Mutex
+	active  bool     // A line is being read
+	prompt  string   // Prompt of the line being read
+	limit   int      // Characters allowed, 0 for no counter
+	input   []rune   // Text typed so far, when live
+	pending []tuiKey // Keys read after the last Enter, like a pasted line
+	width   int      // Terminal width when the line started
+	row     int      // Row of the cursor in the drawn line
+}
+
+// newLineReader returns a reader for the chat's input, live when both
+// stdin and stdout are terminals.
+func newLineReader() *lineReader {
+	return &lineReader{
+		in:      os.Stdin,
+		out:     os.Stdout,
+		scanner: bufio.NewScanner(os.Stdin),
+		live:    isTerminal(os.Stdin) && isTerminal(os.Stdout),
+		keyMode: enterKeyMode,
+	}
+}
+
+// readLine shows prompt and reads a line. With a limit, live lines show a
+// "[count/limit]" counter before the prompt as the text is typed. It returns
+// false at the end of input, or when Ctrl-C or Ctrl-D is pressed on a live
+// line.
+func (r *lineReader) readLine(prompt string, limit int) (string, bool) {
+	if r.live {
+		restore, err := r.keyMode()
+		if err == nil {
+			defer restore()
+			return r.readKeys(prompt, limit)
+		}
+		r.live = false
+	}
+
+	r.mu.Lock()
+	r.active, r.prompt = true, prompt
+	fmt.Fprint(r.out, prompt)
+	r.mu.Unlock()
+	defer r.done()
+
+	if !r.scanner.Scan() {
+		return "", false
+	}
+	return r.scanner.Text(), true
+}
+
+// done marks the line as read.
+func (r *lineReader) done() {
+	r.mu.Lock()
+	r.active = false
+	r.mu.Unlock()
+}
+
+// readKeys edits a line key by key, redrawing it as it changes.
+func (r *lineReader) readKeys(prompt string, limit int) (string, bool) {
+	r.mu.Lock()
+	r.active, r.prompt, r.limit, r.input, r.row = true, prompt, limit, nil, 0
+	r.width = outputWidth()
+	r.draw()
+	r.mu.Unlock()
+	defer r.done()
+
+	buf := make([]byte, 256)
+	var partial []byte // Start of a character split across reads
+	for {
+		r.mu.Lock()
+		keys := r.pending
+		r.pending = nil
+		r.mu.Unlock()
+		if len(keys) == 0 {
+			n, err := r.in.Read(buf)
+			if err != nil {
+				fmt.Fprintln(r.out)
+				return "", false
+			}
+			data := append(partial, buf[:n]...)
+			cut := len(data)
+			for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+				if utf8.RuneStart(data[i]) {
+					if !utf8.FullRune(data[i:]) {
+						cut = i
+					}
+					break
+				}
+			}
+			keys, partial = parseKeys(data[:cut]), append([]byte(nil), data[cut:]...)
+		}
+
+		r.mu.Lock()
+		for i, key := range keys {
+			switch key.Code {
+			case keyEnter:
+				line := string(r.input)
+				r.pending = keys[i+1:]
+				r.active = false
+				r.draw()
+				fmt.Fprintln(r.out)
+				r.mu.Unlock()
+				return line, true
+			case keyInterrupt, keyEOF:
+				if key.Code == keyInterrupt || len(r.input) == 0 {
+					r.active = false
+					fmt.Fprintln(r.out)
+					r.mu.Unlock()
+					return "", false
+				}
+			case keyBackspace:
+				if len(r.input) > 0 {
+					r.input = r.input[:len(r.input)-1]
+				}
+			case keyKillLine:
+				r.input = nil
+			case keyRune:
+				r.input = append(r.input, key.Rune)
+			}
+		}
+		r.draw()
+		r.mu.Unlock()
+	}
+}
+
+// livePrompt returns the prompt with the character counter, if any.
+func (r *lineReader) livePrompt() string {
+	if r.limit <= 0 {
+		return r.prompt
+	}
+	style := theme.Dim
+	if len(r.input) > r.limit {
+		style = theme.Error
+	}
+	return paint(style, fmt.Sprintf("[%d/%d] ", len(r.input), r.limit)) + r.prompt
+}
+
+// clear erases the drawn line, leaving the cursor at its start.
+func (r *lineReader) clear() {
+	if r.row > 0 {
+		fmt.Fprintf(r.out, "\r\033[%dA\033[J", r.row)
+	} else {
+		fmt.Fprint(r.out, "\r\033[J")
+	}
+	r.row = 0
+}
+
+// draw redraws the line being typed, which may wrap over several rows.
+func (r *lineReader) draw() {
+	r.clear()
+	line := r.livePrompt() + string(r.input)
+	fmt.Fprint(r.out, line)
+	if width := displayWidth(ansiPattern.ReplaceAllString(line, "")); width > 0 && r.width > 0 {
+		r.row = (width - 1) / r.width
+	}
+}
+
+// above prints output from elsewhere, like replies from other terminals,
+// above the line being typed.
+func (r *lineReader) above(show func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case !r.active:
+		show()
+	case r.live:
+		r.clear()
+		show()
+		r.draw()
+	default:
+		fmt.Fprint(r.out, "\r")
+		show()
+		fmt.Fprint(r.out, r.prompt)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// testLineReader returns a live reader typing input one byte at a time, as
+// if on a terminal $COLUMNS wide.
+func testLineReader(input string, out *strings.Builder) *lineReader {
+	return &lineReader{
+		in:      iotest.OneByteReader(strings.NewReader(input)),
+		out:     out,
+		live:    true,
+		keyMode: func() (func(), error) { return func() {}, nil },
+	}
+}
+
+func TestLineReaderCounter(t *testing.T) {
+	t.Setenv("COLUMNS", "20")
+	var out strings.Builder
+	r := testLineReader("héllo\x7f\x7fp!\rsecond\n", &out)
+
+	line, ok := r.readLine("You: ", 5)
+	if !ok || line != "hélp!" {
+		t.Fatalf("Expected %q, got %q (%v)", "hélp!", line, ok)
+	}
+	screen := ansiPattern.ReplaceAllString(out.String(), "")
+	for _, want := range []string{"[0/5] You: ", "[5/5] You: héllo", "[3/5] You: hél", "[5/5] You: hélp!\n"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("Expected the line drawn as %q, got %q", want, screen)
+		}
+	}
+
+	// Keys typed after Enter are kept for the next line
+	if line, ok := r.readLine("You: ", 0); !ok || line != "second" {
+		t.Errorf("Expected the pasted second line, got %q (%v)", line, ok)
+	}
+	if _, ok := r.readLine("You: ", 0); ok {
+		t.Error("Expected the end of input")
+	}
+}
+
+func TestLineReaderWraps(t *testing.T) {
+	t.Setenv("COLUMNS", "10")
+	var out strings.Builder
+	r := testLineReader(strings.Repeat("a", 12)+"\x15\x03", &out)
+
+	if _, ok := r.readLine("> ", 0); ok {
+		t.Error("Expected Ctrl-C to end input")
+	}
+	// Once the line wraps, redrawing goes back up to its first row
+	if !strings.Contains(out.String(), "> aaaaaaaaaaaa") || !strings.Contains(out.String(), "\r\033[1A\033[J> ") {
+		t.Errorf("Expected the wrapped line to be redrawn from its first row, got %q", out.String())
+	}
+}
+
+func TestLineReaderAbove(t *testing.T) {
+	var out strings.Builder
+	r := &lineReader{in: strings.NewReader(""), out: &out, scanner: bufio.NewScanner(strings.NewReader(""))}
+	r.active, r.prompt = true, "You: "
+	r.above(func() { out.WriteString("Alice: hi\n") })
+	if got := out.String(); got != "\rAlice: hi\nYou: " {
+		t.Errorf("Expected the prompt shown again below the message, got %q", got)
+	}
+}
@@ -1,39 +1,47 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
 
 	"github.com/spf13/cobra"
 )
 
-func displayRoom(room Room) {
+// roomDetails returns the lines describing a room, as list-rooms prints them.
+func roomDetails(room Room) []string {
 	name := room.Name
 	if name == "" {
 		name = "<empty>"
 	}
 
-	fmt.Printf("Room: %s\n", name)
-	fmt.Printf("- UUID: %s\n", room.UUID)
-	fmt.Printf("- Created: %s\n", room.Created)
-	fmt.Printf("- Updated: %s\n", room.Updated)
-	fmt.Printf("- Status: %s\n", room.Status)
-	fmt.Printf("- Backchanneling: %v\n", room.BackchannelingEnabled)
+	lines := []string{
+		fmt.Sprintf("Room: %s", name),
+		fmt.Sprintf("- UUID: %s", room.UUID),
+		fmt.Sprintf("- Created: %s", room.Created),
+		fmt.Sprintf("- Updated: %s", room.Updated),
+		fmt.Sprintf("- Status: %s", room.Status),
+		fmt.Sprintf("- Backchanneling: %v", room.BackchannelingEnabled),
+	}
 
 	if room.Note != "" {
-		fmt.Printf("- Note: %s\n", room.Note)
+		lines = append(lines, fmt.Sprintf("- Note: %s", room.Note))
 	}
 
 	if len(room.Nomis) > 0 {
-		fmt.Println("- Nomis:")
+		lines = append(lines, "- Nomis:")
 		for _, nomi := range room.Nomis {
-			fmt.Printf("  • %s (%s, %s)\n",
+			lines = append(lines, fmt.Sprintf("  • %s (%s, %s)",
 				nomi.Name,
 				nomi.Gender,
-				nomi.RelationshipType)
+				nomi.RelationshipType))
 		}
 	}
+	return lines
+}
+
+func displayRoom(room Room) {
+	for _, line := range roomDetails(room) {
+		fmt.Println(line)
+	}
 }
 
 var listRoomsCmd = &cobra.Command{
@@ -41,43 +49,15 @@ var listRoomsCmd = &cobra.Command{
 	Short: "List all rooms",
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		client := &http.Client{}
-		url := baseURL + "/rooms"
-
-		// Create the request
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			fmt.Println("Error creating request:", err)
-			return
-		}
-
-		// Set the Authorization header
-		req.Header.Set("Authorization", "Bearer "+apiKey)
-
-		// Perform the request
-		resp, err := client.Do(req)
+		rooms, err := fetchRooms()
 		if err != nil {
-			fmt.Println("Error making request:", err)
-			return
-		}
-		defer resp.Body.Close()
-
-		// Check the response status
-		if resp.StatusCode != http.StatusOK {
-			fmt.Printf("Error: %s\n", resp.Status)
-			return
-		}
-
-		// Parse the response body
-		var response RoomResponse
-		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-			fmt.Println("Error decoding response:", err)
+			fmt.Println(err)
 			return
 		}
 
 		// Print the Rooms
-		fmt.Printf("Total Rooms: %d\n\n", len(response.Rooms))
-		for _, room := range response.Rooms {
+		fmt.Printf("Total Rooms: %d\n\n", len(rooms))
+		for _, room := range rooms {
 			displayRoom(room)
 			fmt.Println()
 		}
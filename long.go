@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Strategies for messages over the API's length limit.
+const (
+	longAsk    = "ask"    // Ask which of the others to use
+	longRefuse = "refuse" // Don't send the message
+	longSplit  = "split"  // Send it as several messages
+	longEdit   = "edit"   // Open it in the editor to trim it
+)
+
+// messageLength returns the length of a message as the API counts it.
+func messageLength(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// tooLong describes how far over the length limit a message is.
+func tooLong(text string) string {
+	n := messageLength(text)
+	return fmt.Sprintf("it is %d characters, %d over the %d-character limit", n, n-maxMessageLength, maxMessageLength)
+}
+
+// splitMessage splits text into messages of at most limit characters,
+// between paragraphs where possible, else between lines, sentences or words.
+// Only words longer than limit are cut.
+func splitMessage(text string, limit int) []string {
+	return splitAt(strings.TrimSpace(text), limit, 0)
+}
+
+// splitAt splits text at the boundaries of level and the levels below.
+func splitAt(text string, limit, level int) []string {
+	if messageLength(text) <= limit {
+		return []string{text}
+	}
+
+	var pieces []string
+	separator := " "
+	switch level {
+	case 0:
+		pieces, separator = strings.Split(text, "\n\n"), "\n\n"
+	case 1:
+		pieces, separator = strings.Split(text, "\n"), "\n"
+	case 2:
+		pieces = sentences(text)
+	case 3:
+		pieces = strings.Fields(text)
+	default:
+		runes := []rune(text)
+		for len(runes) > limit {
+			pieces = append(pieces, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		return append(pieces, string(runes))
+	}
+
+	var messages []string
+	current := ""
+	for _, piece := range pieces {
+		piece = strings.TrimSpace(piece)
+		if piece == "" {
+			continue
+		}
+		if current != "" && messageLength(current+separator+piece) <= limit {
+			current += separator + piece
+			continue
+		}
+		if current != "" {
+			messages = append(messages, current)
+		}
+		split := splitAt(piece, limit, level+1)
+		messages = append(messages, split[:len(split)-1]...)
+		current = split[len(split)-1]
+	}
+	if current != "" {
+		messages = append(messages, current)
+	}
+	return messages
+}
+
+// sentences splits text after the punctuation ending sentences.
+func sentences(text string) []string {
+	var result []string
+	runes := []rune(text)
+	start := 0
+	for i := 0; i+1 < len(runes); i++ {
+		if strings.ContainsRune(".!?…", runes[i]) && unicode.IsSpace(runes[i+1]) {
+			result = append(result, string(runes[start:i+1]))
+			start = i + 1
+		}
+	}
+	return append(result, string(runes[start:]))
+}
+
+// editorCommand returns the command line of the user's editor.
+func editorCommand() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(name); editor != "" {
+			return editor
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// editMessage opens text in the user's editor and returns the edited text.
+func editMessage(text string) (string, error) {
+	f, err := os.CreateTemp("", "nomi-message-*.txt")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	_, err = f.WriteString(text + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	quoted := "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+	if runtime.GOOS == "windows" {
+		quoted = `"` + path + `"`
+	}
+	editor := editorCommand()
+	cmd := shellCommand(context.Background(), editor+" "+quoted)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running editor %q: %v", editor, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// fitMessage applies strategy to a message over the length limit. It
+// returns the messages to send in turn, or none if the message is dropped.
+// Asking needs a live terminal; otherwise the message is refused.
+func fitMessage(text, strategy string, reader *lineReader) []string {
+	for messageLength(text) > maxMessageLength {
+		choice := strategy
+		if choice == longAsk && !reader.live {
+			choice = longRefuse
+		}
+		if choice == longAsk {
+			parts := splitMessage(text, maxMessageLength)
+			fmt.Printf("Your message is too long: %s.\n", tooLong(text))
+			answer, ok := reader.readLine(fmt.Sprintf("[s]plit it into %d messages, [e]dit it or [c]ancel? ", len(parts)), 0)
+			if !ok {
+				return nil
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "s", "split":
+				choice = longSplit
+			case "e", "edit":
+				choice = longEdit
+			default:
+				fmt.Println("Message not sent.")
+				return nil
+			}
+		}
+
+		switch choice {
+		case longSplit:
+			return splitMessage(text, maxMessageLength)
+		case longEdit:
+			edited, err := editMessage(text)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+			if edited == "" {
+				fmt.Println("Message not sent.")
+				return nil
+			}
+			text = edited
+			if strategy == longEdit && messageLength(text) > maxMessageLength {
+				fmt.Printf("Your message is still too long: %s.\n", tooLong(text))
+			}
+		default:
+			fmt.Printf("Message not sent: %s.\n", tooLong(text))
+			return nil
+		}
+	}
+	return []string{text}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  []string
+	}{
+		{"Short enough.", 20, []string{"Short enough."}},
+		{"First paragraph.\n\nSecond one.", 20, []string{"First paragraph.", "Second one."}},
+		{"One. Two! Three? Four.", 10, []string{"One. Two!", "Three?", "Four."}},
+		{"no sentence ends here at all", 12, []string{"no sentence", "ends here at", "all"}},
+		{"abcdefghijkl mn", 5, []string{"abcde", "fghij", "kl mn"}},
+		{"Para one is long. It has two sentences.\n\nShort.", 25, []string{"Para one is long.", "It has two sentences.", "Short."}},
+	}
+	for _, test := range tests {
+		got := splitMessage(test.text, test.limit)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitMessage(%q, %d) = %q, want %q", test.text, test.limit, got, test.want)
+		}
+		for _, message := range got {
+			if messageLength(message) > test.limit {
+				t.Errorf("splitMessage(%q, %d) returned %q, over the limit", test.text, test.limit, message)
+			}
+		}
+	}
+}
+
+func TestFitMessage(t *testing.T) {
+	long := strings.Repeat("This sentence is here to fill the message. ", 20)
+	reader := &lineReader{}
+
+	var messages []string
+	output := captureStdout(t, func() { messages = fitMessage(long, longAsk, reader) })
+	if messages != nil || !strings.Contains(output, "Message not sent: it is 860 characters, 260 over the 600-character limit.") {
+		t.Errorf("Expected the message to be refused without a terminal to ask on, got %q (%q)", messages, output)
+	}
+
+	messages = fitMessage(long, longSplit, reader)
+	if len(messages) != 2 || messages[0]+" "+messages[1] != strings.TrimSpace(long) {
+		t.Errorf("Expected the message split in 2, got %q", messages)
+	}
+
+	if messages := fitMessage("Hello", longRefuse, reader); !reflect.DeepEqual(messages, []string{"Hello"}) {
+		t.Errorf("Expected a short message unchanged, got %q", messages)
+	}
+}
+
+func TestFitMessageEdit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the editor is an sh command in this test")
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `sh -c 'echo "Trimmed." > "$0"'`)
+	reader := &lineReader{}
+	var messages []string
+	captureStdout(t, func() { messages = fitMessage(strings.Repeat("x", maxMessageLength+1), longEdit, reader) })
+	if !reflect.DeepEqual(messages, []string{"Trimmed."}) {
+		t.Errorf("Expected the edited message, got %q", messages)
+	}
+}
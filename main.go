@@ -10,17 +10,38 @@ import (
 var apiKey string  // Store the API key globally
 var baseURL string // Store the base API URL globally
 
+// defaultAPIURL is used when NOMI_API_URL is not set.
+const defaultAPIURL = "https://api.nomi.ai/v1"
+
+// noAPIKeyAnnotation marks commands that run without Nomi API credentials.
+const noAPIKeyAnnotation = "nomi-cli/no-api-key"
+
 func main() {
 	var rootCmd = &cobra.Command{
 		Use:   "nomi-cli",
 		Short: "A CLI client for the Nomi.ai API",
 		Long:  `nomi-cli is a command-line client to interact with the Nomi.ai API`,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupTheme(); err != nil {
+				fmt.Fprintln(os.Stderr, "Warning:", err)
+			}
+			if cmd.Annotations[noAPIKeyAnnotation] == "true" {
+				return nil
+			}
+
 			// Load the API key from the environment variable if not provided as a flag
 			if apiKey == "" {
 				apiKey = os.Getenv("bb58e912-527d-40af-b585-00bfd684c603")
 			}
 
+			// Replayed sessions never reach the API, so no real key is needed
+			if apiKey == "" && replayDir != "" {
+				apiKey = "replay"
+			}
+			if recordDir != "" && replayDir != "" {
+				return fmt.Errorf("--record and --replay cannot be used together")
+			}
+
 			// Ensure an API key is available
 			if apiKey == "" {
 				return fmt.Errorf("API key not found. Please set the NOMI_API_KEY environment variable or use the -k flag")
@@ -28,7 +49,12 @@ func main() {
 			// Load the base API URL from the environment variable
 			baseURL = os.Getenv("NOMI_API_URL")
 			if baseURL == "" {
-				baseURL = "https://api.nomi.ai/v1" // Default value if environment variable is not set
+				baseURL = defaultAPIURL // Default value if environment variable is not set
+			}
+
+			// Enable HTTP debug logging from the environment
+			if envEnabled("NOMI_DEBUG") {
+				debugHTTP = true
 			}
 			return nil
 		},
@@ -37,15 +63,50 @@ func main() {
 	// Allow overriding the API key via a flag
 	rootCmd.PersistentFlags().StringVarP(&apiKey, "api-key", "k", "", "API key for Nomi.ai (overrides NOMI_API_KEY)")
 
+	// HTTP debugging
+	rootCmd.PersistentFlags().BoolVarP(&debugHTTP, "verbose", "v", false, "Log API requests and responses to stderr (also NOMI_DEBUG=1)")
+	rootCmd.PersistentFlags().BoolVar(&debugHTTP, "debug", false, "Alias for --verbose")
+	rootCmd.PersistentFlags().StringVar(&traceFile, "trace-file", "", "Write API requests and responses to a HAR file")
+
+	// Output
+	rootCmd.PersistentFlags().StringVar(&themeName, "theme", "", "Color theme: dark, light, high-contrast, monochrome or one from config (also NOMI_THEME)")
+
+	// Offline testing
+	rootCmd.PersistentFlags().StringVar(&recordDir, "record", "", "Record every API interaction as cassettes in this directory")
+	rootCmd.PersistentFlags().StringVar(&replayDir, "replay", "", "Replay API responses from cassettes in this directory instead of the network")
+
 	// Add commands
 	rootCmd.AddCommand(listNomisCmd)
 	rootCmd.AddCommand(getNomiCmd)
 	rootCmd.AddCommand(chatCmd)
 	rootCmd.AddCommand(listRoomsCmd)
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(mockServerCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(mcpCmd)
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(sendCmd)
+	rootCmd.AddCommand(askCmd)
+	rootCmd.AddCommand(converseCmd)
+	rootCmd.AddCommand(webhookCmd)
+	rootCmd.AddCommand(scheduleCmd)
+	rootCmd.AddCommand(bridgeCmd)
+	rootCmd.AddCommand(pluginCmd)
+	rootCmd.AddCommand(hookCmd)
+	rootCmd.AddCommand(tuiCmd)
+	rootCmd.AddCommand(themeCmd)
+	rootCmd.AddCommand(sessionsCmd)
+
+	// Add nomi-cli-<name> executables found on PATH
+	addPluginCommands(rootCmd)
 
 	// Execute the root command
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+
+	// Let webhook deliveries started by the command finish
+	webhookDeliveries.Wait()
+
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
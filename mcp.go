@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+const mcpProtocolVersion = "2025-06-18"
+
+// JSON-RPC 2.0 messages exchanged with MCP clients, one per line.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// mcpTool describes a tool and the function implementing it. The handler
+// returns the structured result, which is also sent as JSON text for clients
+// that don't read structured content.
+type mcpTool struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	InputSchema  map[string]interface{} `json:"inputSchema"`
+	OutputSchema map[string]interface{} `json:"outputSchema"`
+	handler      func(args map[string]string) (interface{}, error)
+}
+
+// objectSchema builds a JSON schema for an object with string properties.
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func stringProperty(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+var nomiSchema = objectSchema(map[string]interface{}{
+	"uuid":             stringProperty("Nomi UUID"),
+	"name":             stringProperty("Nomi name"),
+	"gender":           stringProperty("Nomi gender"),
+	"created":          stringProperty("Creation timestamp"),
+	"relationshipType": stringProperty("Relationship with the user"),
+})
+
+var messageSchema = objectSchema(map[string]interface{}{
+	"uuid": stringProperty("Message UUID"),
+	"text": stringProperty("Message text"),
+	"sent": stringProperty("Timestamp the message was sent"),
+})
+
+var mcpTools = []mcpTool{
+	{
+		Name:        "list_nomis",
+		Description: "List all Nomis available to the user.",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		OutputSchema: objectSchema(map[string]interface{}{
+			"nomis": map[string]interface{}{"type": "array", "items": nomiSchema},
+		}, "nomis"),
+		handler: func(args map[string]string) (interface{}, error) {
+			nomis, err := fetchNomis()
+			if err != nil {
+				return nil, err
+			}
+			return NomiResponse{Nomis: nomis}, nil
+		},
+	},
+	{
+		Name:        "get_nomi",
+		Description: "Get the details of a Nomi given its UUID, a unique UUID prefix or its name.",
+		InputSchema: objectSchema(map[string]interface{}{
+			"nomi": stringProperty("Nomi UUID, UUID prefix or name"),
+		}, "nomi"),
+		OutputSchema: nomiSchema,
+		handler: func(args map[string]string) (interface{}, error) {
+			return resolveNomi(args["nomi"])
+		},
+	},
+	{
+		Name:        "list_rooms",
+		Description: "List all rooms and the Nomis in them.",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		OutputSchema: objectSchema(map[string]interface{}{
+			"rooms": map[string]interface{}{"type": "array", "items": objectSchema(map[string]interface{}{
+				"uuid":                  stringProperty("Room UUID"),
+				"name":                  stringProperty("Room name"),
+				"created":               stringProperty("Creation timestamp"),
+				"updated":               stringProperty("Last update timestamp"),
+				"status":                stringProperty("Room status"),
+				"backchannelingEnabled": map[string]interface{}{"type": "boolean"},
+				"nomis":                 map[string]interface{}{"type": "array", "items": nomiSchema},
+				"note":                  stringProperty("Room note"),
+			})},
+		}, "rooms"),
+		handler: func(args map[string]string) (interface{}, error) {
+			rooms, err := fetchRooms()
+			if err != nil {
+				return nil, err
+			}
+			return RoomResponse{Rooms: rooms}, nil
+		},
+	},
+	{
+		Name:        "send_message",
+		Description: "Send a message to a Nomi and return its reply.",
+		InputSchema: objectSchema(map[string]interface{}{
+			"nomi":    stringProperty("Nomi UUID, UUID prefix or name"),
+			"message": stringProperty("Message text to send"),
+		}, "nomi", "message"),
+		OutputSchema: objectSchema(map[string]interface{}{
+			"sentMessage":  messageSchema,
+			"replyMessage": messageSchema,
+		}, "sentMessage", "replyMessage"),
+		handler: func(args map[string]string) (interface{}, error) {
+			if args["message"] == "" {
+				return nil, fmt.Errorf("message is required")
+			}
+			nomi, err := resolveNomi(args["nomi"])
+			if err != nil {
+				return nil, err
+			}
+			return sendChat(nomi, args["message"])
+		},
+	},
+}
+
+// serveMCP runs an MCP server reading requests from in and writing responses
+// to out until in is closed.
+func serveMCP(in io.Reader, out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var request rpcRequest
+		if err := json.Unmarshal(line, &request); err != nil {
+			encoder.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+				Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+			continue
+		}
+
+		// Notifications have no ID and get no response
+		if len(request.ID) == 0 {
+			continue
+		}
+
+		response := rpcResponse{JSONRPC: "2.0", ID: request.ID}
+		response.Result, response.Error = handleMCPRequest(request)
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func handleMCPRequest(request rpcRequest) (interface{}, *rpcError) {
+	switch request.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "nomi-cli", "version": Version},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": mcpTools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string            `json:"name"`
+			Arguments map[string]string `json:"arguments"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		for _, tool := range mcpTools {
+			if tool.Name == params.Name {
+				return callMCPTool(tool, params.Arguments), nil
+			}
+		}
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "unknown tool: " + params.Name}
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + request.Method}
+}
+
+// callMCPTool runs a tool. Tool failures are reported in the result, as the
+// MCP specification requires, so the model can see and react to them.
+func callMCPTool(tool mcpTool, args map[string]string) map[string]interface{} {
+	if args == nil {
+		args = map[string]string{}
+	}
+	result, err := tool.handler(args)
+	if err != nil {
+		return map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": err.Error()}},
+			"isError": true,
+		}
+	}
+
+	text, _ := json.Marshal(result)
+	return map[string]interface{}{
+		"content":           []map[string]string{{"type": "text", "text": string(text)}},
+		"structuredContent": result,
+		"isError":           false,
+	}
+}
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Run a Model Context Protocol server over stdio",
+	Long: `Run a Model Context Protocol (MCP) server over stdio.
+
+The server exposes the list_nomis, get_nomi, list_rooms and send_message tools
+so AI tooling can query and message Nomis. Configure your MCP client to launch
+"nomi-cli mcp" with NOMI_API_KEY set.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := serveMCP(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "Error running MCP server:", err)
+		}
+	},
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func runMCP(t *testing.T, requests ...string) []rpcResponse {
+	t.Helper()
+	var out bytes.Buffer
+	if err := serveMCP(strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var responses []rpcResponse
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var response rpcResponse
+		if err := decoder.Decode(&response); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func TestMCPInitializeAndListTools(t *testing.T) {
+	responses := runMCP(t,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"unknown"}`,
+	)
+
+	// The notification gets no response
+	if len(responses) != 3 {
+		t.Fatalf("Expected 3 responses, got %d", len(responses))
+	}
+
+	tools := responses[1].Result.(map[string]interface{})["tools"].([]interface{})
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.(map[string]interface{})["name"].(string))
+	}
+	if strings.Join(names, ",") != "list_nomis,get_nomi,list_rooms,send_message" {
+		t.Errorf("Unexpected tools: %v", names)
+	}
+
+	if responses[2].Error == nil || responses[2].Error.Code != rpcMethodNotFound {
+		t.Errorf("Expected method not found error, got %+v", responses[2])
+	}
+}
+
+func TestMCPToolCalls(t *testing.T) {
+	server := httptest.NewServer(newMockServer().handler())
+	defer server.Close()
+	baseURL = server.URL
+	apiKey = "test-api-key"
+
+	responses := runMCP(t,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"send_message","arguments":{"nomi":"alice","message":"Hi"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"get_nomi","arguments":{"nomi":"Zed"}}}`,
+	)
+
+	result := responses[0].Result.(map[string]interface{})
+	if result["isError"] != false {
+		t.Fatalf("Expected success, got %+v", result)
+	}
+	structured := result["structuredContent"].(map[string]interface{})
+	reply := structured["replyMessage"].(map[string]interface{})
+	if reply["text"] != "You said: Hi" {
+		t.Errorf("Unexpected reply: %+v", reply)
+	}
+
+	failed := responses[1].Result.(map[string]interface{})
+	if failed["isError"] != true {
+		t.Errorf("Expected tool error for unknown Nomi, got %+v", failed)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// mockServer is an in-memory implementation of the Nomi v1 endpoints used by
+// nomi-cli, for demos, CI and development without a real account.
+type mockServer struct {
+	mu        sync.Mutex
+	nomis     []Nomi
+	rooms     []Room
+	replies   map[string][]string  // Scripted replies keyed by Nomi UUID, name or "*"
+	replyNext map[string]int       // Next scripted reply per Nomi UUID
+	messages  map[string][]Message // Conversation with each Nomi, by UUID
+
+	latency   time.Duration
+	errorRate float64
+	rand      *rand.Rand
+	now       func() time.Time
+}
+
+// newMockServer creates a mock server with the built-in sample data.
+func newMockServer() *mockServer {
+	alice := Nomi{
+		UUID:             "6a3e8f5c-2b4d-4e6f-8a1b-3c5d7e9f0a21",
+		Gender:           "Female",
+		Name:             "Alice",
+		Created:          "2024-01-01T12:00:00.000Z",
+		RelationshipType: "Friend",
+	}
+	bob := Nomi{
+		UUID:             "9c1d2e3f-4a5b-4c6d-8e7f-0a1b2c3d4e52",
+		Gender:           "Male",
+		Name:             "Bob",
+		Created:          "2024-02-01T12:00:00.000Z",
+		RelationshipType: "Mentor",
+	}
+	return &mockServer{
+		nomis: []Nomi{alice, bob},
+		rooms: []Room{{
+			UUID:    "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f3",
+			Name:    "Lounge",
+			Created: "2024-03-01T12:00:00.000Z",
+			Updated: "2024-03-01T12:00:00.000Z",
+			Status:  "Default",
+			Nomis:   []Nomi{alice, bob},
+		}},
+		replies:   make(map[string][]string),
+		replyNext: make(map[string]int),
+		messages:  make(map[string][]Message),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:       time.Now,
+	}
+}
+
+// loadFixtures replaces the sample data with the files found in dir:
+// nomis.json and rooms.json use the API response shapes, and replies.json maps
+// a Nomi UUID or name (or "*" for all) to a list of replies used in turn.
+// Missing files keep the built-in data.
+func (s *mockServer) loadFixtures(dir string) error {
+	var nomis NomiResponse
+	if ok, err := readFixture(filepath.Join(dir, "nomis.json"), &nomis); err != nil {
+		return err
+	} else if ok {
+		s.nomis = nomis.Nomis
+		s.rooms = nil
+	}
+
+	var rooms RoomResponse
+	if ok, err := readFixture(filepath.Join(dir, "rooms.json"), &rooms); err != nil {
+		return err
+	} else if ok {
+		s.rooms = rooms.Rooms
+	}
+
+	if _, err := readFixture(filepath.Join(dir, "replies.json"), &s.replies); err != nil {
+		return err
+	}
+	return nil
+}
+
+func readFixture(path string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("error decoding %s: %v", path, err)
+	}
+	return true, nil
+}
+
+func (s *mockServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /nomis", s.handleListNomis)
+	mux.HandleFunc("GET /nomis/{id}", s.handleGetNomi)
+	mux.HandleFunc("POST /nomis/{id}/chat", s.handleChat)
+	mux.HandleFunc("GET /nomis/{id}/messages", s.handleMessages)
+	mux.HandleFunc("GET /rooms", s.handleListRooms)
+	return s.middleware(mux)
+}
+
+// middleware applies authentication, injected latency and injected errors.
+func (s *mockServer) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			writeAPIError(w, http.StatusUnauthorized, "InvalidAPIKey")
+			return
+		}
+
+		if s.latency > 0 {
+			time.Sleep(s.latency)
+		}
+
+		s.mu.Lock()
+		fail := s.errorRate > 0 && s.rand.Float64() < s.errorRate
+		s.mu.Unlock()
+		if fail {
+			writeAPIError(w, http.StatusInternalServerError, "InternalServerError")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *mockServer) handleListNomis(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, NomiResponse{Nomis: s.nomis})
+}
+
+func (s *mockServer) handleGetNomi(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nomi, ok := s.findNomi(r.PathValue("id"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "NomiNotFound")
+		return
+	}
+	writeJSON(w, nomi)
+}
+
+func (s *mockServer) handleListRooms(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rooms := s.rooms
+	if rooms == nil {
+		rooms = []Room{}
+	}
+	writeJSON(w, RoomResponse{Rooms: rooms})
+}
+
+func (s *mockServer) handleChat(w http.ResponseWriter, r *http.Request) {
+	var chatRequest ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&chatRequest); err != nil || chatRequest.MessageText == "" {
+		writeAPIError(w, http.StatusBadRequest, "InvalidBody")
+		return
+	}
+	if len([]rune(chatRequest.MessageText)) > maxMessageLength {
+		writeAPIError(w, http.StatusBadRequest, "MessageLengthLimitExceeded")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nomi, ok := s.findNomi(r.PathValue("id"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "NomiNotFound")
+		return
+	}
+
+	sent := Message{UUID: newMockUUID(s.rand), Text: chatRequest.MessageText, Sent: s.timestamp()}
+	reply := Message{UUID: newMockUUID(s.rand), Text: s.nextReply(nomi, chatRequest.MessageText), Sent: s.timestamp()}
+	s.messages[nomi.UUID] = append(s.messages[nomi.UUID], sent, reply)
+
+	writeJSON(w, ChatResponse{SentMessage: sent, ReplyMessage: reply})
+}
+
+// handleMessages returns the conversation with a Nomi so far, oldest first.
+// It is not part of the Nomi API: it lets demos and tests check what was
+// sent.
+func (s *mockServer) handleMessages(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nomi, ok := s.findNomi(r.PathValue("id"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "NomiNotFound")
+		return
+	}
+	messages := s.messages[nomi.UUID]
+	if messages == nil {
+		messages = []Message{}
+	}
+	writeJSON(w, map[string][]Message{"messages": messages})
+}
+
+// nextReply returns the next scripted reply for nomi, or echoes the message.
+func (s *mockServer) nextReply(nomi Nomi, text string) string {
+	script := s.replies[nomi.UUID]
+	if script == nil {
+		script = s.replies[nomi.Name]
+	}
+	if script == nil {
+		script = s.replies["*"]
+	}
+	if len(script) == 0 {
+		return fmt.Sprintf("You said: %s", text)
+	}
+	i := s.replyNext[nomi.UUID]
+	s.replyNext[nomi.UUID] = i + 1
+	return script[i%len(script)]
+}
+
+func (s *mockServer) findNomi(id string) (Nomi, bool) {
+	for _, nomi := range s.nomis {
+		if nomi.UUID == id {
+			return nomi, true
+		}
+	}
+	return Nomi{}, false
+}
+
+func (s *mockServer) timestamp() string {
+	return s.now().UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func newMockUUID(r *rand.Rand) string {
+	b := make([]byte, 16)
+	r.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes an error in the shape used by the Nomi API.
+func writeAPIError(w http.ResponseWriter, status int, errorType string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"type": errorType},
+	})
+}
+
+var mockPort int
+var mockFixtures string
+var mockLatency time.Duration
+var mockErrorRate float64
+
+var mockServerCmd = &cobra.Command{
+	Use:   "mock-server",
+	Short: "Run a local mock of the Nomi API",
+	Long: `Run a local mock of the Nomi v1 API for demos, CI and development.
+
+The mock serves /nomis, /nomis/{id}, /nomis/{id}/chat and /rooms from in-memory
+data. Point nomi-cli at it with NOMI_API_URL=http://localhost:<port>. It also
+keeps every message exchanged, listed by /nomis/{id}/messages (not part of the
+real API) so demos and CI jobs can check what was sent.
+
+The fixtures directory may contain nomis.json and rooms.json (same shape as the
+API responses) and replies.json, mapping a Nomi UUID or name ("*" for all) to
+replies used in turn. Without scripted replies, messages are echoed back.`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		server := newMockServer()
+		if mockFixtures != "" {
+			if err := server.loadFixtures(mockFixtures); err != nil {
+				fmt.Println("Error loading fixtures:", err)
+				return
+			}
+		}
+		if mockErrorRate < 0 || mockErrorRate > 1 {
+			fmt.Println("Error: --error-rate must be between 0 and 1")
+			return
+		}
+		server.latency = mockLatency
+		server.errorRate = mockErrorRate
+
+		addr := fmt.Sprintf(":%d", mockPort)
+		fmt.Printf("Mock Nomi API listening on http://localhost%s\n", addr)
+		if err := http.ListenAndServe(addr, server.handler()); err != nil {
+			fmt.Println("Error running mock server:", err)
+		}
+	},
+}
+
+func init() {
+	mockServerCmd.Flags().IntVarP(&mockPort, "port", "p", 8080, "Port to listen on")
+	mockServerCmd.Flags().StringVar(&mockFixtures, "fixtures", "", "Directory with nomis.json, rooms.json and replies.json")
+	mockServerCmd.Flags().DurationVar(&mockLatency, "latency", 0, "Delay added to every response (e.g. 500ms)")
+	mockServerCmd.Flags().Float64Var(&mockErrorRate, "error-rate", 0, "Fraction of requests failing with 500 (0 to 1)")
+}
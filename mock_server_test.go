@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func postChat(t *testing.T, url, text string) (*http.Response, ChatResponse) {
+	t.Helper()
+	body, _ := json.Marshal(ChatRequest{MessageText: text})
+	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer test-api-key")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer resp.Body.Close()
+	var chatResponse ChatResponse
+	json.NewDecoder(resp.Body).Decode(&chatResponse)
+	return resp, chatResponse
+}
+
+func TestMockServerEndpoints(t *testing.T) {
+	server := httptest.NewServer(newMockServer().handler())
+	defer server.Close()
+
+	baseURL = server.URL
+	apiKey = "test-api-key"
+
+	nomis, err := fetchNomis()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(nomis) != 2 {
+		t.Fatalf("Expected 2 Nomis, got %d", len(nomis))
+	}
+
+	nomi, err := resolveNomi("bob")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := fetchNomi(nomi.UUID); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	rooms, err := fetchRooms()
+	if err != nil || len(rooms) != 1 {
+		t.Errorf("Expected 1 room, got %d (%v)", len(rooms), err)
+	}
+
+	resp, chat := postChat(t, server.URL+"/nomis/"+nomi.UUID+"/chat", "Hello")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK, got %s", resp.Status)
+	}
+	if chat.ReplyMessage.Text != "You said: Hello" || chat.SentMessage.Text != "Hello" {
+		t.Errorf("Unexpected echo reply: %+v", chat)
+	}
+
+	var conversation struct {
+		Messages []Message `json:"messages"`
+	}
+	if err := apiGet("/nomis/"+nomi.UUID+"/messages", &conversation); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(conversation.Messages) != 2 || conversation.Messages[0].Text != "Hello" || conversation.Messages[1].Text != "You said: Hello" {
+		t.Errorf("Expected the exchange to be kept, got %+v", conversation.Messages)
+	}
+
+	if _, err := fetchNomi("unknown"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected 404 for unknown Nomi, got %v", err)
+	}
+
+	resp, _ = postChat(t, server.URL+"/nomis/"+nomi.UUID+"/chat", strings.Repeat("a", maxMessageLength+1))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for over-long message, got %s", resp.Status)
+	}
+}
+
+func TestMockServerFixturesAndScriptedReplies(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "nomis.json"), []byte(`{"nomis":[{"uuid":"n-1","name":"Carol"}]}`), 0600)
+	os.WriteFile(filepath.Join(dir, "replies.json"), []byte(`{"Carol":["One","Two"]}`), 0600)
+
+	mock := newMockServer()
+	if err := mock.loadFixtures(dir); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	server := httptest.NewServer(mock.handler())
+	defer server.Close()
+
+	for _, expected := range []string{"One", "Two", "One"} {
+		_, chat := postChat(t, server.URL+"/nomis/n-1/chat", "Hi")
+		if chat.ReplyMessage.Text != expected {
+			t.Errorf("Expected %q, got %q", expected, chat.ReplyMessage.Text)
+		}
+	}
+}
+
+func TestMockServerInjectedErrors(t *testing.T) {
+	mock := newMockServer()
+	mock.errorRate = 1
+	server := httptest.NewServer(mock.handler())
+	defer server.Close()
+
+	baseURL = server.URL
+	apiKey = "test-api-key"
+
+	if _, err := fetchNomis(); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Expected injected 500 error, got %v", err)
+	}
+}
+
+func TestMockServerRequiresAuthorization(t *testing.T) {
+	server := httptest.NewServer(newMockServer().handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/nomis")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAI chat-completions request and response shapes, limited to the fields
+// the proxy reads or fills in.
+type openAIChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the message content, which may be a plain string or a list of
+// typed content parts.
+func (m openAIMessage) text() string {
+	var s string
+	if json.Unmarshal(m.Content, &s) == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(m.Content, &parts) == nil {
+		var texts []string
+		for _, part := range parts {
+			if part.Type == "text" {
+				texts = append(texts, part.Text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+type openAIChoice struct {
+	Index        int               `json:"index"`
+	Message      *openAIReplyDelta `json:"message,omitempty"`
+	Delta        *openAIReplyDelta `json:"delta,omitempty"`
+	FinishReason *string           `json:"finish_reason"`
+}
+
+type openAIReplyDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type openAICompletion struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+}
+
+type openAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// openAIHandler exposes the Nomis as OpenAI-compatible models. Callers
+// authenticate with a gateway token as the API key, and only see the Nomis
+// the token allows.
+func (g *gateway) openAIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/models", handleOpenAIModels)
+	mux.HandleFunc("POST /v1/chat/completions", handleOpenAIChat)
+	return g.authenticated(mux, func(w http.ResponseWriter) {
+		writeOpenAIError(w, http.StatusUnauthorized, "invalid gateway token")
+	})
+}
+
+// allowedNomis lists the Nomis the caller's gateway token allows.
+func allowedNomis(r *http.Request) ([]Nomi, error) {
+	token := gatewayTokenFrom(r.Context())
+	nomis, err := fetchNomis()
+	if err != nil {
+		return nil, err
+	}
+	var allowed []Nomi
+	for _, nomi := range nomis {
+		if token.allows(nomi.UUID) {
+			allowed = append(allowed, nomi)
+		}
+	}
+	return allowed, nil
+}
+
+func handleOpenAIModels(w http.ResponseWriter, r *http.Request) {
+	nomis, err := allowedNomis(r)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	models := make([]openAIModel, 0, len(nomis))
+	for _, nomi := range nomis {
+		models = append(models, openAIModel{
+			ID:      nomi.Name,
+			Object:  "model",
+			Created: parseAPITime(nomi.Created).Unix(),
+			OwnedBy: "nomi",
+		})
+	}
+	writeJSON(w, map[string]interface{}{"object": "list", "data": models})
+}
+
+func handleOpenAIChat(w http.ResponseWriter, r *http.Request) {
+	var request openAIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	// Nomis keep their own conversation memory, so only the last user
+	// message is forwarded.
+	var text string
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if request.Messages[i].Role == "user" {
+			text = request.Messages[i].text()
+			break
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		writeOpenAIError(w, http.StatusBadRequest, "no user message to send")
+		return
+	}
+
+	nomis, err := allowedNomis(r)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	nomi, err := matchNomi(nomis, request.Model)
+	if err != nil {
+		writeOpenAIError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	chatResponse, err := sendChat(nomi, text)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	id := "chatcmpl-" + chatResponse.ReplyMessage.UUID
+	created := parseAPITime(chatResponse.ReplyMessage.Sent).Unix()
+	reply := chatResponse.ReplyMessage.Text
+	stop := "stop"
+
+	if request.Stream {
+		streamOpenAIReply(w, id, created, nomi.Name, reply)
+		return
+	}
+
+	writeJSON(w, openAICompletion{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   nomi.Name,
+		Choices: []openAIChoice{{
+			Message:      &openAIReplyDelta{Role: "assistant", Content: reply},
+			FinishReason: &stop,
+		}},
+		Usage: &openAIUsage{},
+	})
+}
+
+// streamOpenAIReply emulates a streamed completion: the Nomi API returns the
+// whole reply at once, so it is sent as server-sent events word by word.
+func streamOpenAIReply(w http.ResponseWriter, id string, created int64, model, reply string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+
+	send := func(choice openAIChoice) {
+		data, _ := json.Marshal(openAICompletion{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []openAIChoice{choice},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	send(openAIChoice{Delta: &openAIReplyDelta{Role: "assistant"}})
+	for _, chunk := range splitKeepingSpaces(reply) {
+		send(openAIChoice{Delta: &openAIReplyDelta{Content: chunk}})
+	}
+	stop := "stop"
+	send(openAIChoice{Delta: &openAIReplyDelta{}, FinishReason: &stop})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// splitKeepingSpaces splits s into words, each keeping its trailing
+// whitespace, so the chunks concatenate back to s.
+func splitKeepingSpaces(s string) []string {
+	var chunks []string
+	start := 0
+	for i := 1; i < len(s); i++ {
+		if s[i-1] == ' ' && s[i] != ' ' {
+			chunks = append(chunks, s[start:i])
+			start = i
+		}
+	}
+	if start < len(s) {
+		chunks = append(chunks, s[start:])
+	}
+	return chunks
+}
+
+func writeOpenAIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": message, "type": "nomi_error"},
+	})
+}
+
+// parseAPITime parses a Nomi API timestamp, falling back to the current time.
+func parseAPITime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Now()
+	}
+	return t
+}
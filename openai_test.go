@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// startOpenAIProxy serves the OpenAI-compatible API with a gateway token
+// allowing allowNomis, and returns the token's secret.
+func startOpenAIProxy(t *testing.T, allowNomis []string) (*httptest.Server, string) {
+	t.Helper()
+	api := httptest.NewServer(newMockServer().handler())
+	t.Cleanup(api.Close)
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	token, secret, err := issueGatewayToken("openai", allowNomis)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	gw := &gateway{tokens: []gatewayToken{token}, log: io.Discard}
+	proxy := httptest.NewServer(gw.openAIHandler())
+	t.Cleanup(proxy.Close)
+	return proxy, secret
+}
+
+func TestOpenAIModels(t *testing.T) {
+	proxy, secret := startOpenAIProxy(t, nil)
+
+	resp := gatewayRequest(t, "GET", proxy.URL+"/v1/models", secret, "")
+	defer resp.Body.Close()
+
+	var result struct {
+		Object string        `json:"object"`
+		Data   []openAIModel `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.Object != "list" || len(result.Data) != 2 || result.Data[0].ID != "Alice" {
+		t.Errorf("Unexpected models: %+v", result)
+	}
+}
+
+func TestOpenAIChatCompletion(t *testing.T) {
+	proxy, secret := startOpenAIProxy(t, nil)
+
+	body := `{"model":"Alice","messages":[
+		{"role":"system","content":"ignored"},
+		{"role":"user","content":"first"},
+		{"role":"assistant","content":"ignored"},
+		{"role":"user","content":[{"type":"text","text":"Hello there"}]}]}`
+	resp := gatewayRequest(t, "POST", proxy.URL+"/v1/chat/completions", secret, body)
+	defer resp.Body.Close()
+
+	var completion openAICompletion
+	json.NewDecoder(resp.Body).Decode(&completion)
+	if completion.Object != "chat.completion" || completion.Model != "Alice" || len(completion.Choices) != 1 {
+		t.Fatalf("Unexpected completion: %+v", completion)
+	}
+	choice := completion.Choices[0]
+	if choice.Message.Role != "assistant" || choice.Message.Content != "You said: Hello there" {
+		t.Errorf("Unexpected message: %+v", choice.Message)
+	}
+	if choice.FinishReason == nil || *choice.FinishReason != "stop" {
+		t.Errorf("Expected finish_reason stop, got %v", choice.FinishReason)
+	}
+}
+
+func TestOpenAIChatCompletionStream(t *testing.T) {
+	proxy, secret := startOpenAIProxy(t, nil)
+
+	body := `{"model":"bob","stream":true,"messages":[{"role":"user","content":"Hi  you"}]}`
+	resp := gatewayRequest(t, "POST", proxy.URL+"/v1/chat/completions", secret, body)
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected event stream, got %q", ct)
+	}
+
+	var content strings.Builder
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "data: ")
+		if line == "" {
+			continue
+		}
+		if line == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk openAICompletion
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			t.Fatalf("Error decoding chunk %q: %v", line, err)
+		}
+		if chunk.Object != "chat.completion.chunk" {
+			t.Errorf("Unexpected chunk object %q", chunk.Object)
+		}
+		content.WriteString(chunk.Choices[0].Delta.Content)
+	}
+
+	if !done {
+		t.Error("Expected stream to end with [DONE]")
+	}
+	if content.String() != "You said: Hi  you" {
+		t.Errorf("Expected streamed content to reassemble the reply, got %q", content.String())
+	}
+}
+
+func TestOpenAIChatUnknownModel(t *testing.T) {
+	proxy, secret := startOpenAIProxy(t, nil)
+
+	body := `{"model":"Zed","messages":[{"role":"user","content":"Hi"}]}`
+	resp := gatewayRequest(t, "POST", proxy.URL+"/v1/chat/completions", secret, body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %s", resp.Status)
+	}
+}
+
+func TestOpenAIRequiresGatewayToken(t *testing.T) {
+	proxy, _ := startOpenAIProxy(t, nil)
+
+	for _, token := range []string{"", "nomi_gw_wrong", "test-api-key"} {
+		resp := gatewayRequest(t, "GET", proxy.URL+"/v1/models", token, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for token %q, got %s", token, resp.Status)
+		}
+	}
+}
+
+func TestOpenAIAllowList(t *testing.T) {
+	alice := newMockServer().nomis[0]
+	proxy, secret := startOpenAIProxy(t, []string{alice.UUID})
+
+	resp := gatewayRequest(t, "GET", proxy.URL+"/v1/models", secret, "")
+	var result struct {
+		Data []openAIModel `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if len(result.Data) != 1 || result.Data[0].ID != alice.Name {
+		t.Errorf("Expected only %s, got %+v", alice.Name, result.Data)
+	}
+
+	body := `{"model":"Bob","messages":[{"role":"user","content":"Hi"}]}`
+	resp = gatewayRequest(t, "POST", proxy.URL+"/v1/chat/completions", secret, body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a Nomi outside the allow list, got %s", resp.Status)
+	}
+}
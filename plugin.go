@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// pluginPrefix starts the file name of plugin executables.
+const pluginPrefix = "nomi-cli-"
+
+// pluginAnnotation marks commands that run a plugin, with its path.
+const pluginAnnotation = "nomi-cli/plugin"
+
+// plugin is an external nomi-cli-<name> executable found on PATH.
+type plugin struct {
+	Name     string
+	Path     string
+	Shadowed []string // Executables with the same name later on PATH
+}
+
+// discoverPlugins lists plugin executables on PATH, by name. The first one on
+// PATH wins, as the shell would pick it.
+func discoverPlugins() []plugin {
+	var plugins []plugin
+	index := make(map[string]int)
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := pluginName(entry)
+			if !ok {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if i, seen := index[name]; seen {
+				plugins[i].Shadowed = append(plugins[i].Shadowed, path)
+				continue
+			}
+			index[name] = len(plugins)
+			plugins = append(plugins, plugin{Name: name, Path: path})
+		}
+	}
+
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// pluginName returns the command name of a plugin executable.
+func pluginName(entry os.DirEntry) (string, bool) {
+	name := entry.Name()
+	if !strings.HasPrefix(name, pluginPrefix) || entry.IsDir() {
+		return "", false
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return "", false
+	}
+
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(name))
+		if ext != ".exe" && ext != ".bat" && ext != ".cmd" {
+			return "", false
+		}
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	} else if info.Mode()&0111 == 0 {
+		return "", false
+	}
+
+	name = strings.TrimPrefix(name, pluginPrefix)
+	return name, name != ""
+}
+
+// pluginEnv is the environment passed to plugins: the settings resolved by
+// the root command, so plugins don't have to resolve them again.
+func pluginEnv() []string {
+	env := append(os.Environ(),
+		"NOMI_API_KEY="+apiKey,
+		"NOMI_API_URL="+baseURL,
+	)
+	if dir, err := configDir(); err == nil {
+		env = append(env, "NOMI_CONFIG_DIR="+dir)
+	}
+	if executable, err := os.Executable(); err == nil {
+		env = append(env, "NOMI_CLI="+executable)
+	}
+	if debugHTTP {
+		env = append(env, "NOMI_DEBUG=1")
+	}
+	return env
+}
+
+// parsePluginArgs parses nomi-cli's own flags, which precede the plugin name
+// in args, into the root command's persistent flags, marking them Changed.
+// It returns the arguments after the plugin name, which belong to the
+// plugin.
+func parsePluginArgs(root *cobra.Command, args []string) ([]string, error) {
+	flags := pflag.NewFlagSet(root.Name(), pflag.ContinueOnError)
+	flags.AddFlagSet(root.PersistentFlags())
+	flags.SetInterspersed(false) // Stop at the plugin name
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() == 0 {
+		return nil, nil
+	}
+	return flags.Args()[1:], nil
+}
+
+// addPluginCommands registers a command for each plugin not hidden by a
+// built-in command.
+func addPluginCommands(rootCmd *cobra.Command) {
+	for _, p := range discoverPlugins() {
+		if cmd, _, err := rootCmd.Find([]string{p.Name}); err == nil && cmd != rootCmd {
+			continue
+		}
+		rootCmd.AddCommand(newPluginCommand(p))
+	}
+}
+
+func newPluginCommand(p plugin) *cobra.Command {
+	var pluginArgs []string
+	return &cobra.Command{
+		Use:                p.Name,
+		Short:              fmt.Sprintf("Plugin (%s)", p.Path),
+		Annotations:        map[string]string{pluginAnnotation: p.Path},
+		DisableFlagParsing: true, // Flags after the name are the plugin's own
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if pluginArgs, err = parsePluginArgs(cmd.Root(), os.Args[1:]); err != nil {
+				return err
+			}
+			return cmd.Root().PersistentPreRunE(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			child := exec.Command(p.Path, pluginArgs...)
+			child.Env = pluginEnv()
+			child.Stdin = os.Stdin
+			child.Stdout = os.Stdout
+			child.Stderr = os.Stderr
+			if err := child.Run(); err != nil {
+				if exitErr, ok := err.(*exec.ExitError); ok {
+					os.Exit(exitErr.ExitCode())
+				}
+				fmt.Println("Error running plugin:", err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Manage plugins",
+	Long: `Manage plugins.
+
+Any executable named nomi-cli-<name> on PATH can be run as "nomi-cli <name>".
+Plugins receive their arguments unchanged, and the API key, base URL and
+config directory resolved by nomi-cli in the NOMI_API_KEY, NOMI_API_URL and
+NOMI_CONFIG_DIR environment variables. NOMI_CLI holds the path of nomi-cli
+itself.`,
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List plugins found on PATH",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		plugins := discoverPlugins()
+		if len(plugins) == 0 {
+			fmt.Printf("No plugins found. Add %s<name> executables to your PATH.\n", pluginPrefix)
+			return
+		}
+		for _, p := range plugins {
+			fmt.Printf("%s: %s\n", p.Name, p.Path)
+			if found, _, err := cmd.Root().Find([]string{p.Name}); err == nil && found != cmd.Root() && found.Annotations[pluginAnnotation] == "" {
+				fmt.Println("  - warning: hidden by the built-in command of the same name")
+			}
+			for _, shadowed := range p.Shadowed {
+				fmt.Printf("  - warning: %s is hidden by this plugin\n", shadowed)
+			}
+		}
+	},
+}
+
+func init() {
+	pluginCmd.AddCommand(pluginListCmd)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// writePlugin creates an executable shell script in dir.
+func writePlugin(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiscoverPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts in this test")
+	}
+	first, second := t.TempDir(), t.TempDir()
+	hello := writePlugin(t, first, "nomi-cli-hello", "")
+	shadowed := writePlugin(t, second, "nomi-cli-hello", "")
+	writePlugin(t, second, "nomi-cli-stats", "")
+	os.WriteFile(filepath.Join(second, "nomi-cli-notes"), nil, 0644) // Not executable
+	os.WriteFile(filepath.Join(second, "other-tool"), nil, 0755)
+	t.Setenv("PATH", first+string(os.PathListSeparator)+second)
+
+	plugins := discoverPlugins()
+	if len(plugins) != 2 {
+		t.Fatalf("Expected 2 plugins, got %+v", plugins)
+	}
+	if plugins[0].Name != "hello" || plugins[0].Path != hello {
+		t.Errorf("Expected hello from the first PATH entry, got %+v", plugins[0])
+	}
+	if len(plugins[0].Shadowed) != 1 || plugins[0].Shadowed[0] != shadowed {
+		t.Errorf("Expected the second hello to be shadowed, got %+v", plugins[0].Shadowed)
+	}
+	if plugins[1].Name != "stats" {
+		t.Errorf("Expected stats, got %+v", plugins[1])
+	}
+}
+
+func TestParsePluginArgs(t *testing.T) {
+	var key string
+	var verbose bool
+	root := &cobra.Command{Use: "nomi-cli"}
+	root.PersistentFlags().StringVarP(&key, "api-key", "k", "", "")
+	root.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "")
+
+	// The plugin's name can also be a flag value
+	args := []string{"-k", "hello", "--verbose", "hello", "-k", "plugin-flag"}
+	got, err := parsePluginArgs(root, args)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if strings.Join(got, " ") != "-k plugin-flag" {
+		t.Errorf("Unexpected plugin args: %q", got)
+	}
+	if key != "hello" || !verbose || !root.PersistentFlags().Changed("api-key") {
+		t.Errorf("Expected the root flags to be set, got key %q, verbose %v", key, verbose)
+	}
+}
+
+func TestPluginCommandEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts in this test")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	writePlugin(t, dir, "nomi-cli-hello", `echo "$NOMI_API_KEY $NOMI_API_URL $NOMI_CONFIG_DIR $*" > `+out+"\n")
+	t.Setenv("PATH", dir)
+	configDir := t.TempDir()
+	t.Setenv("NOMI_CONFIG_DIR", configDir)
+	t.Setenv("NOMI_API_URL", "http://nomi.test")
+
+	oldArgs, oldKey := os.Args, apiKey
+	defer func() { os.Args, apiKey = oldArgs, oldKey }()
+
+	rootCmd := &cobra.Command{
+		Use: "nomi-cli",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			baseURL = os.Getenv("NOMI_API_URL")
+			return nil
+		},
+	}
+	rootCmd.PersistentFlags().StringVarP(&apiKey, "api-key", "k", "", "")
+	addPluginCommands(rootCmd)
+
+	args := []string{"-k", "plugin-key", "hello", "--name", "Alice"}
+	os.Args = append([]string{"nomi-cli"}, args...)
+	rootCmd.SetArgs(args)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "plugin-key http://nomi.test " + configDir + " --name Alice\n"
+	if string(data) != want {
+		t.Errorf("Expected %q, got %q", want, data)
+	}
+}
+
+func TestBuiltinCommandsWinOverPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts in this test")
+	}
+	dir := t.TempDir()
+	writePlugin(t, dir, "nomi-cli-send", "")
+	t.Setenv("PATH", dir)
+
+	rootCmd := &cobra.Command{Use: "nomi-cli"}
+	rootCmd.AddCommand(sendCmd)
+	addPluginCommands(rootCmd)
+
+	cmd, _, err := rootCmd.Find([]string{"send"})
+	if err != nil || cmd != sendCmd {
+		t.Errorf("Expected the built-in send command, got %v (%v)", cmd, err)
+	}
+}
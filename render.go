@@ -0,0 +1,356 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Kinds of inline markup in replies, styled by the theme.
+const (
+	styleAction   = "action"   // *roleplay actions*
+	styleBold     = "bold"     // **bold**
+	styleEmphasis = "emphasis" // _emphasis_
+)
+
+// defaultWidth is used when the terminal width cannot be determined.
+const defaultWidth = 80
+
+// wideRanges lists the code points shown two cells wide: East Asian wide and
+// fullwidth characters, and emoji.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F},
+	{0x231A, 0x231B},
+	{0x23E9, 0x23EC},
+	{0x2E80, 0x303E},
+	{0x3041, 0x33FF},
+	{0x3400, 0x4DBF},
+	{0x4E00, 0x9FFF},
+	{0xA000, 0xA4CF},
+	{0xAC00, 0xD7A3},
+	{0xF900, 0xFAFF},
+	{0xFE30, 0xFE4F},
+	{0xFF00, 0xFF60},
+	{0xFFE0, 0xFFE6},
+	{0x1F004, 0x1F004},
+	{0x1F18E, 0x1F18E},
+	{0x1F200, 0x1F2FF},
+	{0x1F300, 0x1F64F},
+	{0x1F680, 0x1F6FF},
+	{0x1F900, 0x1F9FF},
+	{0x1FA70, 0x1FAFF},
+	{0x20000, 0x3FFFD},
+}
+
+// runeWidth returns the number of terminal cells r takes on its own.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0x200D, // Zero-width joiner
+		r >= 0xFE00 && r <= 0xFE0F,   // Variation selectors
+		r >= 0x1F3FB && r <= 0x1F3FF, // Skin tone modifiers
+		r >= 0xE0100 && r <= 0xE01EF,
+		unicode.Is(unicode.Mn, r), unicode.Is(unicode.Me, r), unicode.IsControl(r):
+		return 0
+	}
+	for _, wide := range wideRanges {
+		if r >= wide[0] && r <= wide[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+// displayWidth returns the number of terminal cells s takes. Emoji joined
+// with zero-width joiners count once, and a character followed by the emoji
+// variation selector counts as wide.
+func displayWidth(s string) int {
+	width := 0
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		w := runeWidth(runes[i])
+		if i > 0 && runes[i-1] == 0x200D {
+			w = 0
+		}
+		if w == 1 && i+1 < len(runes) && runes[i+1] == 0xFE0F {
+			w = 2
+		}
+		width += w
+	}
+	return width
+}
+
+// outputWidth returns the width to wrap output to: $COLUMNS, else the
+// terminal's width, else defaultWidth.
+func outputWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if width, _, err := terminalSize(); err == nil && width > 0 {
+		return width
+	}
+	return defaultWidth
+}
+
+// segment is a run of text drawn in one kind of style.
+type segment struct {
+	Text  string
+	Style string
+}
+
+// word is a unit of wrapping: text between spaces, possibly made of several
+// styles, like "*waves*," which ends with a plain comma.
+type word []segment
+
+func (w word) width() int {
+	width := 0
+	for _, s := range w {
+		width += displayWidth(s.Text)
+	}
+	return width
+}
+
+// parseInline splits a line into words, styling *actions*, **bold** and
+// _emphasis_. Unmatched markers are kept as written.
+func parseInline(line string) []word {
+	var words []word
+	var current word
+	style := ""
+	var text []rune
+
+	flush := func() {
+		if len(text) > 0 {
+			current = append(current, segment{Text: string(text), Style: style})
+			text = nil
+		}
+	}
+	endWord := func() {
+		flush()
+		if len(current) > 0 {
+			words = append(words, current)
+			current = nil
+		}
+	}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == ' ' || r == '\t' {
+			endWord()
+			continue
+		}
+
+		marker, markerStyle := "", ""
+		switch {
+		case r == '*' && i+1 < len(runes) && runes[i+1] == '*':
+			marker, markerStyle = "**", styleBold
+		case r == '*':
+			marker, markerStyle = "*", styleAction
+		case r == '_' && (i == 0 || !isWordRune(runes[i-1]) || style == styleEmphasis):
+			marker, markerStyle = "_", styleEmphasis
+		}
+		if marker == "" {
+			text = append(text, r)
+			continue
+		}
+
+		if style == markerStyle {
+			// Closing marker
+			flush()
+			style = ""
+			i += len(marker) - 1
+			continue
+		}
+		if style == "" && closes(runes[i+len(marker):], marker) {
+			flush()
+			style = markerStyle
+			i += len(marker) - 1
+			continue
+		}
+		// Unmatched or nested markers are kept as written
+		text = append(text, []rune(marker)...)
+		i += len(marker) - 1
+	}
+	endWord()
+	return words
+}
+
+// isWordRune reports whether r is part of a word, for _emphasis_ detection.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// closes reports whether rest contains the closing marker of a span that
+// starts right before it.
+func closes(rest []rune, marker string) bool {
+	if len(rest) == 0 || rest[0] == ' ' {
+		return false
+	}
+	s := string(rest)
+	end := strings.Index(s, marker)
+	if marker == "*" {
+		// Bold markers inside an action don't close it
+		for end >= 0 && strings.HasPrefix(s[end:], "**") {
+			next := strings.Index(s[end+2:], "*")
+			if next < 0 {
+				return false
+			}
+			end += 2 + next
+		}
+	}
+	return end > 0 && !strings.HasSuffix(s[:end], " ")
+}
+
+// splitWord breaks a word wider than width into pieces that fit.
+func splitWord(w word, width int) []word {
+	var pieces []word
+	var piece word
+	pieceWidth := 0
+	for _, s := range w {
+		var text []rune
+		for _, r := range s.Text {
+			rw := runeWidth(r)
+			if pieceWidth+rw > width && pieceWidth > 0 {
+				if len(text) > 0 {
+					piece = append(piece, segment{Text: string(text), Style: s.Style})
+					text = nil
+				}
+				pieces = append(pieces, piece)
+				piece, pieceWidth = nil, 0
+			}
+			text = append(text, r)
+			pieceWidth += rw
+		}
+		if len(text) > 0 {
+			piece = append(piece, segment{Text: string(text), Style: s.Style})
+		}
+	}
+	if len(piece) > 0 {
+		pieces = append(pieces, piece)
+	}
+	return pieces
+}
+
+// wrapWords lays words out in lines of at most width cells.
+func wrapWords(words []word, width int) [][]word {
+	if width < 1 {
+		width = 1
+	}
+	lines := [][]word{nil}
+	lineWidth := 0
+	for _, w := range words {
+		ww := w.width()
+		if ww > width {
+			pieces := splitWord(w, width)
+			for i, piece := range pieces {
+				if lineWidth > 0 || i > 0 {
+					lines = append(lines, nil)
+				}
+				lines[len(lines)-1] = []word{piece}
+				lineWidth = piece.width()
+			}
+			continue
+		}
+		if lineWidth > 0 && lineWidth+1+ww > width {
+			lines = append(lines, nil)
+			lineWidth = 0
+		}
+		if lineWidth > 0 {
+			lineWidth++
+		}
+		lines[len(lines)-1] = append(lines[len(lines)-1], w)
+		lineWidth += ww
+	}
+	return lines
+}
+
+// formatLine joins words with spaces, styled or plain.
+func formatLine(words []word, styled bool) string {
+	var b strings.Builder
+	for i, w := range words {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		for _, s := range w {
+			if styled {
+				b.WriteString(paint(theme.inline(s.Style), s.Text))
+			} else {
+				b.WriteString(s.Text)
+			}
+		}
+	}
+	return b.String()
+}
+
+// listItem returns the bullet to draw for a markdown list item and the rest
+// of the line, or "" if line is not a list item.
+func listItem(line string) (string, string) {
+	trimmed := strings.TrimLeft(line, " ")
+	for _, marker := range []string{"- ", "* ", "+ ", "• "} {
+		if strings.HasPrefix(trimmed, marker) {
+			return "• ", trimmed[len(marker):]
+		}
+	}
+	if i := strings.Index(trimmed, ". "); i > 0 {
+		if _, err := strconv.Atoi(trimmed[:i]); err == nil {
+			return trimmed[:i+2], trimmed[i+2:]
+		}
+	}
+	return "", line
+}
+
+// wrapText word-wraps text to width cells without styling, keeping line
+// breaks.
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		var words []word
+		for _, field := range strings.Fields(paragraph) {
+			words = append(words, word{{Text: field}})
+		}
+		for _, line := range wrapWords(words, width) {
+			lines = append(lines, formatLine(line, false))
+		}
+	}
+	return lines
+}
+
+// renderReply formats a reply for the terminal: meta (like a timestamp)
+// dimmed, "Name: " in color, then the text word-wrapped to width, with
+// continuation lines indented under the text, markdown emphasis and *actions*
+// styled and list items bulleted.
+func renderReply(meta, name, color, text string, width int) string {
+	prefix := meta + name + ": "
+	indent := strings.Repeat(" ", displayWidth(prefix))
+	available := width - len(indent)
+
+	var b strings.Builder
+	first := true
+	if available < 20 {
+		// Too narrow for a hanging indent: start the text under the name
+		indent, available = "", width
+		b.WriteString(paint(theme.Dim, meta) + paint(color, name) + ":")
+		first = false
+	} else {
+		b.WriteString(paint(theme.Dim, meta) + paint(color, name) + ": ")
+	}
+	for _, paragraph := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		bullet, content := listItem(paragraph)
+		bulletIndent := strings.Repeat(" ", displayWidth(bullet))
+
+		for i, line := range wrapWords(parseInline(content), available-len(bulletIndent)) {
+			if !first {
+				b.WriteString("\n" + indent)
+			}
+			first = false
+			if i == 0 {
+				b.WriteString(bullet)
+			} else {
+				b.WriteString(bulletIndent)
+			}
+			b.WriteString(formatLine(line, true))
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+	}{
+		{"hello", 5},
+		{"héllo", 5},
+		{"é", 1},     // Combining accent
+		{"你好", 4},     // CJK
+		{"こんにちは", 10}, // Kana
+		{"😀", 2},      // Emoji
+		{"👍🏽", 2},     // Skin tone modifier
+		{"👩‍💻", 2},    // Zero-width joiner sequence
+		{"❤️", 2},     // Emoji variation selector
+		{"ｈｉ", 4},     // Fullwidth
+		{"a😀b你", 6},
+	}
+	for _, tt := range tests {
+		if got := displayWidth(tt.text); got != tt.width {
+			t.Errorf("displayWidth(%q) = %d, expected %d", tt.text, got, tt.width)
+		}
+	}
+}
+
+// plainWords returns the text and style of each segment of each word.
+func plainWords(words []word) []string {
+	var out []string
+	for _, w := range words {
+		var parts []string
+		for _, s := range w {
+			switch s.Style {
+			case styleAction:
+				parts = append(parts, "A("+s.Text+")")
+			case styleBold:
+				parts = append(parts, "B("+s.Text+")")
+			case styleEmphasis:
+				parts = append(parts, "I("+s.Text+")")
+			default:
+				parts = append(parts, s.Text)
+			}
+		}
+		out = append(out, strings.Join(parts, ""))
+	}
+	return out
+}
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"*waves happily*, hi!", []string{"A(waves)", "A(happily),", "hi!"}},
+		{"that's **really** _nice_", []string{"that's", "B(really)", "I(nice)"}},
+		{"2 * 3 = 6", []string{"2", "*", "3", "=", "6"}},
+		{"my_var_name stays", []string{"my_var_name", "stays"}},
+		{"*unclosed action", []string{"*unclosed", "action"}},
+		{"*smiles **wide***", []string{"A(smiles)", "A(**wide**)"}},
+	}
+	for _, tt := range tests {
+		if got := plainWords(parseInline(tt.line)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseInline(%q) = %q, expected %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	got := wrapText("the quick brown fox\njumps over supercalifragilistic", 10)
+	want := []string{"the quick", "brown fox", "jumps over", "supercalif", "ragilistic"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	// Wide characters take two cells
+	got = wrapText("你好世界 你好", 6)
+	want = []string{"你好世", "界", "你好"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestRenderReply(t *testing.T) {
+	text := "*smiles* Sure! Here is what I think about it:\n- first point that is quite long\n2. second"
+	got := ansiPattern.ReplaceAllString(renderReply("", "Alice", theme.Nomi, text, 36), "")
+	want := strings.Join([]string{
+		"Alice: smiles Sure! Here is what I",
+		"       think about it:",
+		"       • first point that is quite",
+		"         long",
+		"       2. second",
+	}, "\n") + "\n"
+	if got != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	styled := renderReply("", "Alice", theme.Nomi, "*smiles*", 36)
+	if !strings.Contains(styled, theme.Action+"smiles"+ansiReset) {
+		t.Errorf("Expected the action to be styled, got %q", styled)
+	}
+
+	// Narrow terminals start the text under the name
+	got = ansiPattern.ReplaceAllString(renderReply("", "Alice", theme.Nomi, "hello there friend", 12), "")
+	if got != "Alice:\nhello there\nfriend\n" {
+		t.Errorf("Unexpected narrow rendering: %q", got)
+	}
+
+	// Metadata comes first and is part of the hanging indent
+	got = ansiPattern.ReplaceAllString(renderReply("[12:30:05] ", "Bob", theme.Nomi, "one two three four", 40), "")
+	if got != "[12:30:05] Bob: one two three four\n" {
+		t.Errorf("Unexpected rendering with metadata: %q", got)
+	}
+	got = ansiPattern.ReplaceAllString(renderReply("[12:30:05] ", "Bob", theme.Nomi, "one two three four five six", 40), "")
+	if got != "[12:30:05] Bob: one two three four five\n"+strings.Repeat(" ", 16)+"six\n" {
+		t.Errorf("Unexpected wrapping with metadata: %q", got)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ambiguousError is returned when a query matches more than one Nomi.
+type ambiguousError struct {
+	Query      string
+	Candidates []Nomi
+}
+
+func (e *ambiguousError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q matches several Nomis, please be more specific:", e.Query)
+	for _, nomi := range e.Candidates {
+		fmt.Fprintf(&b, "\n  • %s (%s)", nomi.Name, nomi.UUID)
+	}
+	return b.String()
+}
+
+// resolveNomi finds a Nomi from a full UUID, a unique UUID prefix, an exact
+// name or a partial name. A full UUID is looked up directly; anything else is
+// matched against the list returned by /nomis.
+func resolveNomi(query string) (Nomi, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return Nomi{}, fmt.Errorf("no Nomi specified")
+	}
+
+	if uuidPattern.MatchString(query) {
+		return fetchNomi(query)
+	}
+
+	nomis, err := fetchNomis()
+	if err != nil {
+		return Nomi{}, err
+	}
+	return matchNomi(nomis, query)
+}
+
+// nomiMatchStages are the ways a query can designate a Nomi: exact UUID,
+// exact name, UUID prefix, name substring and finally a fuzzy subsequence
+// match on the name. The first exactMatchStages compare whole UUIDs and
+// names; q is lowercase.
+var nomiMatchStages = []func(n Nomi, q string) bool{
+	func(n Nomi, q string) bool { return strings.EqualFold(n.UUID, q) },
+	func(n Nomi, q string) bool { return strings.EqualFold(n.Name, q) },
+	func(n Nomi, q string) bool { return strings.HasPrefix(strings.ToLower(n.UUID), q) },
+	func(n Nomi, q string) bool { return strings.Contains(strings.ToLower(n.Name), q) },
+	func(n Nomi, q string) bool { return isSubsequence(q, strings.ToLower(n.Name)) },
+}
+
+const exactMatchStages = 2
+
+// matchNomi picks the Nomi designated by query, trying each of
+// nomiMatchStages in order. The first stage with any match decides the
+// outcome, so an exact name always wins over partial ones, even a name like
+// "Abe" that is also the start of another Nomi's UUID.
+func matchNomi(nomis []Nomi, query string) (Nomi, error) {
+	return matchNomiStages(nomis, query, nomiMatchStages)
+}
+
+// matchNomiExactly is matchNomi without the partial matches: query must be
+// a Nomi's whole UUID or name, in any case.
+func matchNomiExactly(nomis []Nomi, query string) (Nomi, error) {
+	return matchNomiStages(nomis, query, nomiMatchStages[:exactMatchStages])
+}
+
+func matchNomiStages(nomis []Nomi, query string, stages []func(n Nomi, q string) bool) (Nomi, error) {
+	q := strings.ToLower(query)
+
+	for _, match := range stages {
+		var found []Nomi
+		for _, nomi := range nomis {
+			if match(nomi, q) {
+				found = append(found, nomi)
+			}
+		}
+		switch len(found) {
+		case 0:
+			continue
+		case 1:
+			return found[0], nil
+		default:
+			return Nomi{}, &ambiguousError{Query: query, Candidates: found}
+		}
+	}
+
+	return Nomi{}, fmt.Errorf("no Nomi found matching: %s", query)
+}
+
+// isSubsequence reports whether all runes of needle appear in haystack in order.
+func isSubsequence(needle, haystack string) bool {
+	rest := []rune(needle)
+	if len(rest) == 0 {
+		return false
+	}
+	for _, r := range haystack {
+		if r == rest[0] {
+			rest = rest[1:]
+			if len(rest) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchNomi(t *testing.T) {
+	nomis := []Nomi{
+		{UUID: "a1b2c3d4-0000-4000-8000-000000000001", Name: "Alice"},
+		{UUID: "a1b2ffff-0000-4000-8000-000000000002", Name: "Alicia"},
+		{UUID: "b9e8d7c6-0000-4000-8000-000000000003", Name: "Bob"},
+		{UUID: "c0ffee00-0000-4000-8000-000000000004", Name: "Roberta"},
+		{UUID: "abe00000-0000-4000-8000-000000000005", Name: "Ada"},
+		{UUID: "ada00000-0000-4000-8000-000000000006", Name: "Abe"},
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		expected  string
+		ambiguous bool
+		notFound  bool
+	}{
+		{name: "Full UUID", query: "b9e8d7c6-0000-4000-8000-000000000003", expected: "Bob"},
+		{name: "Unique UUID prefix", query: "c0ff", expected: "Roberta"},
+		{name: "Ambiguous UUID prefix", query: "a1b2", ambiguous: true},
+		{name: "Exact name, case-insensitive", query: "alice", expected: "Alice"},
+		{name: "Exact name wins over partial", query: "Bob", expected: "Bob"},
+		{name: "Exact name wins over UUID prefix", query: "abe", expected: "Abe"},
+		{name: "UUID prefix that is no name", query: "abe0", expected: "Ada"},
+		{name: "Unique partial name", query: "bert", expected: "Roberta"},
+		{name: "Ambiguous partial name", query: "ali", ambiguous: true},
+		{name: "Fuzzy name", query: "rbta", expected: "Roberta"},
+		{name: "No match", query: "Zed", notFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nomi, err := matchNomi(nomis, tt.query)
+			switch {
+			case tt.ambiguous:
+				ambErr, ok := err.(*ambiguousError)
+				if !ok {
+					t.Fatalf("Expected ambiguous error, got %v", err)
+				}
+				if len(ambErr.Candidates) != 2 {
+					t.Errorf("Expected 2 candidates, got %d", len(ambErr.Candidates))
+				}
+			case tt.notFound:
+				if err == nil {
+					t.Errorf("Expected error, got Nomi %q", nomi.Name)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if nomi.Name != tt.expected {
+					t.Errorf("Expected %s, got %s", tt.expected, nomi.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestAmbiguousErrorListsCandidates(t *testing.T) {
+	err := &ambiguousError{
+		Query: "al",
+		Candidates: []Nomi{
+			{UUID: "uuid-1", Name: "Alice"},
+			{UUID: "uuid-2", Name: "Alicia"},
+		},
+	}
+	msg := err.Error()
+	for _, expected := range []string{"Alice (uuid-1)", "Alicia (uuid-2)"} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("Expected %q in error message, got %q", expected, msg)
+		}
+	}
+}
+
+func TestResolveNomiFullUUID(t *testing.T) {
+	const id = "123e4567-e89b-12d3-a456-426614174000"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A full UUID must be fetched directly without listing all Nomis
+		if r.URL.Path != "/nomis/"+id {
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(Nomi{UUID: id, Name: "John"})
+	}))
+	defer server.Close()
+
+	baseURL = server.URL
+	apiKey = "test-api-key"
+
+	nomi, err := resolveNomi(id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if nomi.Name != "John" {
+		t.Errorf("Expected John, got %s", nomi.Name)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// scheduledJob is a message sent to a Nomi on a cron schedule.
+type scheduledJob struct {
+	ID       string `json:"id"`
+	NomiUUID string `json:"nomiUuid"`
+	NomiName string `json:"nomiName"`
+	Cron     string `json:"cron"`
+	Message  string `json:"message"`
+	Missed   string `json:"missed"`  // What to do with runs missed while the scheduler was down
+	Checked  string `json:"checked"` // Time up to which runs have been handled
+}
+
+type scheduleFile struct {
+	Jobs []scheduledJob `json:"jobs"`
+}
+
+// Missed-run policies.
+const (
+	missedSkip    = "skip"     // Ignore runs missed while the scheduler was down
+	missedCatchUp = "catch-up" // Send once for all missed runs when the scheduler starts
+)
+
+// scheduleGrace is how late a run may start and still count as on time.
+const scheduleGrace = 2 * time.Minute
+
+// Actions returned by scheduledJob.due.
+const (
+	scheduleIdle    = ""
+	scheduleRun     = "run"
+	scheduleCatchUp = "catch-up"
+	scheduleSkip    = "skip"
+)
+
+// due reports what to do with the job at now, and the latest occurrence it
+// concerns. Several missed occurrences result in a single catch-up or skip.
+func (j scheduledJob) due(schedule *cronSchedule, now time.Time) (string, time.Time) {
+	checked, err := time.Parse(time.RFC3339, j.Checked)
+	if err != nil {
+		checked = now.Add(-time.Minute)
+	}
+
+	var latest time.Time
+	for next := schedule.next(checked); !next.IsZero() && !next.After(now); next = schedule.next(next) {
+		latest = next
+	}
+	switch {
+	case latest.IsZero():
+		return scheduleIdle, latest
+	case now.Sub(latest) <= scheduleGrace:
+		return scheduleRun, latest
+	case j.Missed == missedCatchUp:
+		return scheduleCatchUp, latest
+	}
+	return scheduleSkip, latest
+}
+
+func schedulePath() (string, error) {
+	return configPath("schedules.json")
+}
+
+func loadSchedules() ([]scheduledJob, error) {
+	path, err := schedulePath()
+	if err != nil {
+		return nil, err
+	}
+	var file scheduleFile
+	err = loadJSONFile(path, &file)
+	return file.Jobs, err
+}
+
+func saveSchedules(jobs []scheduledJob) error {
+	path, err := schedulePath()
+	if err != nil {
+		return err
+	}
+	return saveJSONFile(path, scheduleFile{Jobs: jobs})
+}
+
+// logSchedule prints a scheduler event and appends it to schedule.log.
+func logSchedule(format string, args ...interface{}) {
+	line := fmt.Sprintf("%s %s", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+	fmt.Println(line)
+	if path, err := ensureConfigPath("schedule.log"); err == nil {
+		if f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err == nil {
+			fmt.Fprintln(f, line)
+			f.Close()
+		}
+	}
+}
+
+// runScheduledJob sends the job's message and logs the reply.
+func runScheduledJob(job scheduledJob) {
+	channel, err := openNomiChannel(job.NomiUUID, nil)
+	if err != nil {
+		logSchedule("[job %s] Error: %v", job.ID, err)
+		return
+	}
+	defer channel.Close()
+
+	logSchedule("[job %s] You → %s: %s", job.ID, job.NomiName, job.Message)
+	chatResponse, err := channel.Send(job.Message)
+	if err != nil {
+		logSchedule("[job %s] Error: %v", job.ID, err)
+		return
+	}
+	logSchedule("[job %s] %s: %s", job.ID, job.NomiName, chatResponse.ReplyMessage.Text)
+}
+
+// runScheduleTick handles every job due at now and records progress. The due
+// jobs are sent concurrently, so a slow reply doesn't delay the others, nor
+// the next tick past scheduleGrace.
+func runScheduleTick(now time.Time) error {
+	jobs, err := loadSchedules()
+	if err != nil {
+		return err
+	}
+
+	var running sync.WaitGroup
+	for i, job := range jobs {
+		schedule, err := parseCron(job.Cron)
+		if err != nil {
+			logSchedule("[job %s] Error: %v", job.ID, err)
+			continue
+		}
+
+		action, occurrence := job.due(schedule, now)
+		switch action {
+		case scheduleCatchUp:
+			logSchedule("[job %s] Catching up missed run of %s", job.ID, occurrence.Format(time.RFC3339))
+		case scheduleSkip:
+			logSchedule("[job %s] Skipping missed run of %s", job.ID, occurrence.Format(time.RFC3339))
+		}
+		if action == scheduleRun || action == scheduleCatchUp {
+			running.Add(1)
+			go func(job scheduledJob) {
+				defer running.Done()
+				runScheduledJob(job)
+			}(job)
+		}
+		jobs[i].Checked = now.Format(time.RFC3339)
+	}
+	running.Wait()
+
+	// Reload before saving so jobs added or removed meanwhile are kept
+	current, err := loadSchedules()
+	if err != nil {
+		return err
+	}
+	checked := make(map[string]string)
+	for _, job := range jobs {
+		checked[job.ID] = job.Checked
+	}
+	for i, job := range current {
+		if c, ok := checked[job.ID]; ok {
+			current[i].Checked = c
+		}
+	}
+	return saveSchedules(current)
+}
+
+var scheduleNomi string
+var scheduleCron string
+var scheduleMessage string
+var scheduleMissed string
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Send messages to Nomis on a schedule",
+	Long: `Send messages to Nomis on a schedule.
+
+Jobs use standard five-field cron expressions (minute hour day-of-month month
+day-of-week) in local time and are stored locally. "schedule run" is the
+scheduler: it runs in the foreground, sends due messages and logs the replies
+to the terminal and to schedule.log in the config directory.
+
+Runs missed while the scheduler was down are skipped, or sent once when it
+starts again with --missed catch-up.`,
+}
+
+var scheduleAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Schedule a recurring message",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if scheduleNomi == "" || scheduleCron == "" || scheduleMessage == "" {
+			fmt.Println("Error: --nomi, --cron and --message are required")
+			return
+		}
+		if scheduleMissed != missedSkip && scheduleMissed != missedCatchUp {
+			fmt.Printf("Error: --missed must be %s or %s\n", missedSkip, missedCatchUp)
+			return
+		}
+		schedule, err := parseCron(scheduleCron)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		nomi, err := resolveNomi(scheduleNomi)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		jobs, err := loadSchedules()
+		if err != nil {
+			fmt.Println("Error loading schedules:", err)
+			return
+		}
+		id := 1
+		for _, job := range jobs {
+			if n, err := strconv.Atoi(job.ID); err == nil && n >= id {
+				id = n + 1
+			}
+		}
+
+		now := time.Now()
+		job := scheduledJob{
+			ID:       strconv.Itoa(id),
+			NomiUUID: nomi.UUID,
+			NomiName: nomi.Name,
+			Cron:     scheduleCron,
+			Message:  scheduleMessage,
+			Missed:   scheduleMissed,
+			Checked:  now.Format(time.RFC3339),
+		}
+		if err := saveSchedules(append(jobs, job)); err != nil {
+			fmt.Println("Error saving schedules:", err)
+			return
+		}
+		fmt.Printf("Job %s scheduled for %s, next run %s\n", job.ID, nomi.Name, schedule.next(now).Format(time.RFC1123))
+	},
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List scheduled messages",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		jobs, err := loadSchedules()
+		if err != nil {
+			fmt.Println("Error loading schedules:", err)
+			return
+		}
+		if len(jobs) == 0 {
+			fmt.Println("No scheduled messages.")
+			return
+		}
+		for _, job := range jobs {
+			next := "invalid schedule"
+			if schedule, err := parseCron(job.Cron); err == nil {
+				next = schedule.next(time.Now()).Format(time.RFC1123)
+			}
+			fmt.Printf("Job %s: %s\n", job.ID, job.NomiName)
+			fmt.Printf("- Cron: %s (missed runs: %s)\n", job.Cron, job.Missed)
+			fmt.Printf("- Next run: %s\n", next)
+			fmt.Printf("- Message: %s\n\n", job.Message)
+		}
+	},
+}
+
+var scheduleRemoveCmd = &cobra.Command{
+	Use:         "remove [id]",
+	Short:       "Remove a scheduled message",
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		jobs, err := loadSchedules()
+		if err != nil {
+			fmt.Println("Error loading schedules:", err)
+			return
+		}
+		kept := jobs[:0]
+		for _, job := range jobs {
+			if job.ID != args[0] {
+				kept = append(kept, job)
+			}
+		}
+		if len(kept) == len(jobs) {
+			fmt.Printf("Error: no job %s\n", args[0])
+			return
+		}
+		if err := saveSchedules(kept); err != nil {
+			fmt.Println("Error saving schedules:", err)
+			return
+		}
+		fmt.Printf("Job %s removed.\n", args[0])
+	},
+}
+
+var scheduleRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the scheduler in the foreground",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Scheduler started, press Ctrl+C to stop.")
+		for {
+			if err := runScheduleTick(time.Now()); err != nil {
+				fmt.Println("Error:", err)
+			}
+			// Wake up just after the next minute starts
+			now := time.Now()
+			time.Sleep(now.Truncate(time.Minute).Add(time.Minute + time.Second).Sub(now))
+		}
+	},
+}
+
+func init() {
+	scheduleAddCmd.Flags().StringVar(&scheduleNomi, "nomi", "", "Nomi to message (UUID, UUID prefix or name)")
+	scheduleAddCmd.Flags().StringVar(&scheduleCron, "cron", "", `Cron expression, e.g. "0 9 * * 1-5"`)
+	scheduleAddCmd.Flags().StringVar(&scheduleMessage, "message", "", "Message to send")
+	scheduleAddCmd.Flags().StringVar(&scheduleMissed, "missed", missedSkip, "Policy for runs missed while the scheduler was down: skip or catch-up")
+
+	scheduleCmd.AddCommand(scheduleAddCmd)
+	scheduleCmd.AddCommand(scheduleListCmd)
+	scheduleCmd.AddCommand(scheduleRemoveCmd)
+	scheduleCmd.AddCommand(scheduleRunCmd)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScheduledJobDue(t *testing.T) {
+	schedule, _ := parseCron("0 9 * * *")
+	day := func(d, h, m int) time.Time { return time.Date(2024, 1, d, h, m, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		checked  time.Time
+		now      time.Time
+		missed   string
+		expected string
+		occurred time.Time
+	}{
+		{"Not yet due", day(1, 8, 0), day(1, 8, 59), missedSkip, scheduleIdle, time.Time{}},
+		{"On time", day(1, 8, 59), day(1, 9, 0), missedSkip, scheduleRun, day(1, 9, 0)},
+		{"Slightly late", day(1, 8, 59), day(1, 9, 1), missedSkip, scheduleRun, day(1, 9, 0)},
+		{"Already handled", day(1, 9, 0), day(1, 9, 1), missedSkip, scheduleIdle, time.Time{}},
+		{"Missed and skipped", day(1, 8, 0), day(3, 12, 0), missedSkip, scheduleSkip, day(3, 9, 0)},
+		{"Missed and caught up", day(1, 8, 0), day(3, 12, 0), missedCatchUp, scheduleCatchUp, day(3, 9, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := scheduledJob{Missed: tt.missed, Checked: tt.checked.Format(time.RFC3339)}
+			action, occurrence := job.due(schedule, tt.now)
+			if action != tt.expected || !occurrence.Equal(tt.occurred) {
+				t.Errorf("Expected %q at %s, got %q at %s", tt.expected, tt.occurred, action, occurrence)
+			}
+		})
+	}
+}
+
+func TestRunScheduleTick(t *testing.T) {
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	mock := newMockServer()
+	api := httptest.NewServer(mock.handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	alice, bob := mock.nomis[0], mock.nomis[1]
+	now := time.Date(2024, 1, 1, 9, 0, 30, 0, time.Local)
+	saveSchedules([]scheduledJob{{
+		ID:       "1",
+		NomiUUID: alice.UUID,
+		NomiName: alice.Name,
+		Cron:     "0 9 * * *",
+		Message:  "Standup time",
+		Missed:   missedSkip,
+		Checked:  now.Add(-time.Hour).Format(time.RFC3339),
+	}, {
+		ID:       "2",
+		NomiUUID: bob.UUID,
+		NomiName: bob.Name,
+		Cron:     "0 9 * * *",
+		Message:  "Standup time",
+		Missed:   missedSkip,
+		Checked:  now.Add(-time.Hour).Format(time.RFC3339),
+	}})
+
+	if err := runScheduleTick(now); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := len(mock.messages[alice.UUID]); got != 2 {
+		t.Errorf("Expected one exchange with Alice, got %d messages", got)
+	}
+	if got := len(mock.messages[bob.UUID]); got != 2 {
+		t.Errorf("Expected one exchange with Bob, got %d messages", got)
+	}
+
+	// The run is recorded, so the next tick doesn't send again
+	if err := runScheduleTick(now.Add(30 * time.Second)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := len(mock.messages[alice.UUID]); got != 2 {
+		t.Errorf("Expected no new exchange, got %d messages", got)
+	}
+}
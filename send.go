@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// errEmptyMessage is returned by readMessage when there is no message.
+var errEmptyMessage = errors.New("Error: empty message")
+
+// readMessage returns the message given as arguments, or read from stdin
+// when there are none.
+func readMessage(args []string) (string, error) {
+	message := strings.Join(args, " ")
+	if message == "" {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("Error reading message: %v", err)
+		}
+		message = strings.TrimSpace(string(input))
+	}
+	if message == "" {
+		return "", errEmptyMessage
+	}
+	return message, nil
+}
+
+var sendAttachments []string
+var sendSplit bool
+
+var sendCmd = &cobra.Command{
+	Use:   "send [id|name] [message]",
+	Short: "Send a single message to a Nomi and print the reply",
+	Long: `Send a single message to a Nomi and print the reply.
+
+The message is taken from the remaining arguments, or read from stdin when
+none are given. The Nomi can be given as a full UUID, a unique UUID prefix,
+its name or part of its name.
+
+--attach inlines text files after the message, truncated with a warning on
+stderr to keep the message within the API's length limit. With attachments,
+the message can be left out: stdin is then only read when it isn't a
+terminal.
+
+Messages over the length limit are not sent, unless --split is given: they
+are then sent as several messages, split on paragraph or sentence boundaries,
+each one after the reply to the previous one, and every reply is printed.`,
+	Example: `  nomi-cli send Alice "How was your day?"
+  nomi-cli send Alice --attach notes.txt "Can you summarize these notes?"`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Attachments can be sent on their own
+		message := ""
+		if len(args) > 1 || len(sendAttachments) == 0 || !isTerminal(os.Stdin) {
+			var err error
+			message, err = readMessage(args[1:])
+			if err != nil && !(err == errEmptyMessage && len(sendAttachments) > 0) {
+				fmt.Println(err)
+				return
+			}
+		}
+		if len(sendAttachments) > 0 {
+			var attachments []attachment
+			for _, path := range sendAttachments {
+				a, err := attachFile(path)
+				if err != nil {
+					fmt.Println("Error attaching:", err)
+					return
+				}
+				attachments = append(attachments, a)
+			}
+			var warnings []string
+			message, warnings = attachMessage(message, attachments)
+			for _, warning := range warnings {
+				fmt.Fprintln(os.Stderr, "Warning:", warning)
+			}
+		}
+
+		messages := []string{message}
+		if messageLength(message) > maxMessageLength {
+			if !sendSplit {
+				fmt.Printf("Error: message not sent, %s (use --split to send it as several messages)\n", tooLong(message))
+				return
+			}
+			messages = splitMessage(message, maxMessageLength)
+		}
+
+		channel, err := openNomiChannel(args[0], nil)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer channel.Close()
+
+		for _, message := range messages {
+			chatResponse, err := channel.Send(message)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(chatResponse.ReplyMessage.Text)
+		}
+	},
+}
+
+func init() {
+	sendCmd.Flags().StringArrayVar(&sendAttachments, "attach", nil, "Text file to inline after the message (repeatable)")
+	sendCmd.Flags().BoolVar(&sendSplit, "split", false, "Send a message over the length limit as several messages")
+}
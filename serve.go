@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var serveListen string
+var serveOpenAI bool
+var tokenAllowNomis []string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Expose the Nomi API through a local HTTP server",
+	Long: `Expose the Nomi API through a local HTTP server.
+
+By default the server is a REST gateway mirroring the CLI commands:
+GET /nomis, GET /nomis/{id}, POST /nomis/{id}/chat and GET /rooms, where {id}
+accepts anything the CLI accepts. Callers authenticate with tokens issued by
+"serve token add" instead of the real API key, and each token can be limited
+to some Nomis. Every request is logged to stderr.
+
+With --openai, the server speaks the OpenAI chat-completions protocol:
+/v1/models lists one model per Nomi and /v1/chat/completions sends the last
+user message to the Nomi named by "model". Streaming is emulated with
+server-sent events. Clients use a gateway token as their API key, and only
+see the Nomis it allows.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		tokens, err := loadGatewayTokens()
+		if err != nil {
+			fmt.Println("Error loading tokens:", err)
+			return
+		}
+		if len(tokens) == 0 {
+			fmt.Println("No gateway tokens found. Create one with: nomi-cli serve token add <name>")
+			return
+		}
+
+		gw := &gateway{tokens: tokens, log: os.Stderr}
+		if serveOpenAI {
+			fmt.Printf("OpenAI-compatible API listening on %s (%d tokens)\n", serveListen, len(tokens))
+			if err := http.ListenAndServe(serveListen, gw.openAIHandler()); err != nil {
+				fmt.Println("Error running server:", err)
+			}
+			return
+		}
+
+		fmt.Printf("REST gateway listening on %s (%d tokens)\n", serveListen, len(tokens))
+		if err := http.ListenAndServe(serveListen, gw.handler()); err != nil {
+			fmt.Println("Error running server:", err)
+		}
+	},
+}
+
+var serveTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage REST gateway tokens",
+}
+
+var serveTokenAddCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Issue a new gateway token",
+	Long: `Issue a new gateway token.
+
+Use --nomi (repeatable) to restrict the token to some Nomis; without it the
+token can access every Nomi. The token is only displayed once.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		tokens, err := loadGatewayTokens()
+		if err != nil {
+			fmt.Println("Error loading tokens:", err)
+			return
+		}
+		for _, token := range tokens {
+			if token.Name == name {
+				fmt.Printf("Error: a token named %s already exists\n", name)
+				return
+			}
+		}
+
+		var allowed, allowedNames []string
+		for _, query := range tokenAllowNomis {
+			nomi, err := resolveNomi(query)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			allowed = append(allowed, nomi.UUID)
+			allowedNames = append(allowedNames, nomi.Name)
+		}
+
+		token, secret, err := issueGatewayToken(name, allowed)
+		if err != nil {
+			fmt.Println("Error generating token:", err)
+			return
+		}
+		if err := saveGatewayTokens(append(tokens, token)); err != nil {
+			fmt.Println("Error saving tokens:", err)
+			return
+		}
+
+		fmt.Printf("Token %s created", name)
+		if len(allowedNames) > 0 {
+			fmt.Printf(" for %s", strings.Join(allowedNames, ", "))
+		}
+		fmt.Printf(":\n%s\n", secret)
+		fmt.Println("Store it now, it will not be shown again.")
+	},
+}
+
+var serveTokenListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List gateway tokens",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		tokens, err := loadGatewayTokens()
+		if err != nil {
+			fmt.Println("Error loading tokens:", err)
+			return
+		}
+		if len(tokens) == 0 {
+			fmt.Println("No gateway tokens.")
+			return
+		}
+		for _, token := range tokens {
+			nomis := "all Nomis"
+			if len(token.AllowNomis) > 0 {
+				nomis = strings.Join(token.AllowNomis, ", ")
+			}
+			fmt.Printf("%s (created %s): %s\n", token.Name, token.Created, nomis)
+		}
+	},
+}
+
+var serveTokenRevokeCmd = &cobra.Command{
+	Use:         "revoke [name]",
+	Short:       "Revoke a gateway token",
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		tokens, err := loadGatewayTokens()
+		if err != nil {
+			fmt.Println("Error loading tokens:", err)
+			return
+		}
+		kept := tokens[:0]
+		for _, token := range tokens {
+			if token.Name != args[0] {
+				kept = append(kept, token)
+			}
+		}
+		if len(kept) == len(tokens) {
+			fmt.Printf("Error: no token named %s\n", args[0])
+			return
+		}
+		if err := saveGatewayTokens(kept); err != nil {
+			fmt.Println("Error saving tokens:", err)
+			return
+		}
+		fmt.Printf("Token %s revoked. Restart running gateways to apply.\n", args[0])
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", "localhost:8000", "Address to listen on")
+	serveCmd.Flags().BoolVar(&serveOpenAI, "openai", false, "Serve an OpenAI-compatible chat-completions API")
+
+	serveTokenAddCmd.Flags().StringArrayVar(&tokenAllowNomis, "nomi", nil, "Nomi the token may access (repeatable, default all)")
+
+	serveTokenCmd.AddCommand(serveTokenAddCmd)
+	serveTokenCmd.AddCommand(serveTokenListCmd)
+	serveTokenCmd.AddCommand(serveTokenRevokeCmd)
+	serveCmd.AddCommand(serveTokenCmd)
+}
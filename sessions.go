@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// sessionExchange is a message and its reply in a saved session.
+type sessionExchange struct {
+	Sent      Message `json:"sent"`
+	Reply     Message `json:"reply"`
+	LatencyMs int64   `json:"latencyMs,omitempty"`
+}
+
+// chatSession is a chat session saved in the sessions directory, one file
+// per session, so that it can be resumed later.
+type chatSession struct {
+	ID        int               `json:"id"`
+	Name      string            `json:"name,omitempty"`
+	NomiUUID  string            `json:"nomiUuid"`
+	NomiName  string            `json:"nomiName"`
+	Started   time.Time         `json:"started"`
+	Updated   time.Time         `json:"updated"`
+	Exchanges []sessionExchange `json:"exchanges"`
+}
+
+// sessionsDir returns the directory holding saved sessions.
+func sessionsDir() (string, error) {
+	return configPath("sessions")
+}
+
+// loadSessions returns the saved sessions, most recently active last.
+func loadSessions() ([]*chatSession, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*chatSession
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.Size() == 0 {
+			continue // ID claimed by save, session not written yet
+		}
+		session := &chatSession{}
+		if err := loadJSONFile(filepath.Join(dir, entry.Name()), session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Updated.Before(sessions[j].Updated) })
+	return sessions, nil
+}
+
+// findSession returns the session with the given ID or name.
+func findSession(sessions []*chatSession, query string) (*chatSession, error) {
+	id, err := strconv.Atoi(query)
+	for _, session := range sessions {
+		if (err == nil && session.ID == id) || (session.Name != "" && session.Name == query) {
+			return session, nil
+		}
+	}
+	return nil, fmt.Errorf("Error: no session %q", query)
+}
+
+// latestSession returns the most recently active session with a Nomi, or nil.
+func latestSession(sessions []*chatSession, nomiUUID string) *chatSession {
+	for i := len(sessions) - 1; i >= 0; i-- {
+		if sessions[i].NomiUUID == nomiUUID {
+			return sessions[i]
+		}
+	}
+	return nil
+}
+
+// sessionPath returns the file of a session.
+func sessionPath(id int) (string, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprintf("%d.json", id)), nil
+}
+
+// save writes the session. New sessions get the next free ID on their first
+// save, claimed with an exclusive create so that concurrent chats don't share
+// one.
+func (s *chatSession) save() error {
+	if s.ID == 0 {
+		dir, err := sessionsDir()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		sessions, err := loadSessions()
+		if err != nil {
+			return err
+		}
+		id := 1
+		for _, session := range sessions {
+			if session.ID >= id {
+				id = session.ID + 1
+			}
+		}
+		for ; ; id++ {
+			f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%d.json", id)), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if os.IsExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			f.Close()
+			break
+		}
+		s.ID = id
+	}
+
+	path, err := sessionPath(s.ID)
+	if err != nil {
+		return err
+	}
+	return saveJSONFile(path, s)
+}
+
+// record adds an exchange to the session and saves it.
+func (s *chatSession) record(exchange chatExchange) error {
+	s.Exchanges = append(s.Exchanges, sessionExchange{
+		Sent:      exchange.Response.SentMessage,
+		Reply:     exchange.Response.ReplyMessage,
+		LatencyMs: exchange.Latency.Milliseconds(),
+	})
+	s.Updated = time.Now()
+	return s.save()
+}
+
+// rename names the session, checking no other session has the name.
+func (s *chatSession) rename(name string) error {
+	if _, err := strconv.Atoi(name); err == nil {
+		return fmt.Errorf("Error: session names can't be numbers")
+	}
+	sessions, err := loadSessions()
+	if err != nil {
+		return err
+	}
+	if other, err := findSession(sessions, name); err == nil && other.ID != s.ID {
+		return fmt.Errorf("Error: session %d is already named %q", other.ID, name)
+	}
+	s.Name = name
+	if s.ID == 0 {
+		return nil // Saved with the first exchange
+	}
+	return s.save()
+}
+
+// last returns the last n exchanges, or all of them if n is not positive.
+func (s *chatSession) last(n int) []sessionExchange {
+	if n <= 0 || n >= len(s.Exchanges) {
+		return s.Exchanges
+	}
+	return s.Exchanges[len(s.Exchanges)-n:]
+}
+
+// title describes a session in one line.
+func (s *chatSession) title() string {
+	title := fmt.Sprintf("#%d", s.ID)
+	if s.Name != "" {
+		title += fmt.Sprintf(" %q", s.Name)
+	}
+	exchanges := fmt.Sprintf("%d exchanges", len(s.Exchanges))
+	if len(s.Exchanges) == 1 {
+		exchanges = "1 exchange"
+	}
+	return fmt.Sprintf("%s with %s, %s, last active %s",
+		title, s.NomiName, exchanges, s.Updated.Local().Format("2006-01-02 15:04"))
+}
+
+// sessionNomis lists the Nomis sessions are with, once each, under the name
+// they last had.
+func sessionNomis(sessions []*chatSession) []Nomi {
+	var nomis []Nomi
+	seen := make(map[string]int)
+	for _, session := range sessions {
+		if i, ok := seen[session.NomiUUID]; ok {
+			nomis[i].Name = session.NomiName
+			continue
+		}
+		seen[session.NomiUUID] = len(nomis)
+		nomis = append(nomis, Nomi{UUID: session.NomiUUID, Name: session.NomiName})
+	}
+	return nomis
+}
+
+var sessionsNomi string
+var sessionsShowLast int
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Manage saved chat sessions",
+	Long: `Manage saved chat sessions.
+
+Every chat session is saved locally, so that "chat --resume" can pick up the
+last conversation with a Nomi and "chat --session <name>" a named one.
+Sessions are referred to by number or name.`,
+}
+
+var sessionsListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List saved sessions",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions, err := loadSessions()
+		if err != nil {
+			fmt.Println("Error loading sessions:", err)
+			return
+		}
+		// --nomi is matched like elsewhere, but offline against the Nomis
+		// the sessions are with
+		var nomi Nomi
+		var matchErr error
+		if sessionsNomi != "" {
+			nomi, matchErr = matchNomi(sessionNomis(sessions), sessionsNomi)
+			var ambiguous *ambiguousError
+			if errors.As(matchErr, &ambiguous) {
+				fmt.Println(matchErr)
+				return
+			}
+		}
+		shown := 0
+		for i := len(sessions) - 1; i >= 0; i-- {
+			session := sessions[i]
+			if sessionsNomi != "" && (matchErr != nil || session.NomiUUID != nomi.UUID) {
+				continue
+			}
+			fmt.Println(session.title())
+			shown++
+		}
+		if shown == 0 {
+			fmt.Println("No saved sessions.")
+		}
+	},
+}
+
+var sessionsShowCmd = &cobra.Command{
+	Use:         "show [id|name]",
+	Short:       "Print a saved session",
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions, err := loadSessions()
+		if err != nil {
+			fmt.Println("Error loading sessions:", err)
+			return
+		}
+		session, err := findSession(sessions, args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		fmt.Println(paint(theme.Title, session.title()))
+		for _, exchange := range session.last(sessionsShowLast) {
+			sent := parseAPITime(exchange.Sent.Sent).Local().Format("2006-01-02 15:04:05")
+			replied := parseAPITime(exchange.Reply.Sent).Local().Format("2006-01-02 15:04:05")
+			fmt.Printf("[%s] %s: %s\n", sent, paint(theme.You, "You"), exchange.Sent.Text)
+			fmt.Printf("[%s] %s: %s\n", replied, paint(theme.Nomi, session.NomiName), exchange.Reply.Text)
+		}
+	},
+}
+
+var sessionsRenameCmd = &cobra.Command{
+	Use:         "rename [id|name] [new-name]",
+	Short:       "Name a saved session",
+	Args:        cobra.ExactArgs(2),
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions, err := loadSessions()
+		if err != nil {
+			fmt.Println("Error loading sessions:", err)
+			return
+		}
+		session, err := findSession(sessions, args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := session.rename(args[1]); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Session %d renamed to %q.\n", session.ID, session.Name)
+	},
+}
+
+var sessionsDeleteCmd = &cobra.Command{
+	Use:         "delete [id|name]",
+	Short:       "Delete a saved session",
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions, err := loadSessions()
+		if err != nil {
+			fmt.Println("Error loading sessions:", err)
+			return
+		}
+		session, err := findSession(sessions, args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		path, err := sessionPath(session.ID)
+		if err == nil {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			fmt.Println("Error deleting session:", err)
+			return
+		}
+		fmt.Printf("Session %d deleted.\n", session.ID)
+	},
+}
+
+func init() {
+	sessionsListCmd.Flags().StringVar(&sessionsNomi, "nomi", "", "Only list sessions with this Nomi (UUID, UUID prefix or name)")
+	sessionsShowCmd.Flags().IntVar(&sessionsShowLast, "last", 0, "Only print the last N exchanges")
+
+	sessionsCmd.AddCommand(sessionsListCmd)
+	sessionsCmd.AddCommand(sessionsShowCmd)
+	sessionsCmd.AddCommand(sessionsRenameCmd)
+	sessionsCmd.AddCommand(sessionsDeleteCmd)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	sessionAlice = Nomi{UUID: "6a3e8f5c-2b4d-4e6f-8a1b-3c5d7e9f0a21", Name: "Alice"}
+	sessionBob   = Nomi{UUID: "9c1d2e3f-4a5b-4c6d-8e7f-0a1b2c3d4e52", Name: "Bob"}
+)
+
+// testExchange returns an exchange with the given texts.
+func testExchange(sent, reply string) chatExchange {
+	return chatExchange{
+		Response: ChatResponse{
+			SentMessage:  Message{UUID: "sent-" + sent, Text: sent, Sent: "2024-01-01T12:00:00Z"},
+			ReplyMessage: Message{UUID: "reply-" + reply, Text: reply, Sent: "2024-01-01T12:00:01Z"},
+		},
+		Latency: 500 * time.Millisecond,
+	}
+}
+
+func TestChatSessionSave(t *testing.T) {
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+
+	first := &chatSession{NomiUUID: sessionAlice.UUID, NomiName: "Alice", Started: time.Now()}
+	second := &chatSession{NomiUUID: sessionBob.UUID, NomiName: "Bob", Started: time.Now()}
+	if sessions, _ := loadSessions(); len(sessions) != 0 {
+		t.Fatalf("Expected no sessions before the first exchange, got %d", len(sessions))
+	}
+
+	if err := first.record(testExchange("Hi", "Hello!")); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.record(testExchange("Hey", "Yo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.record(testExchange("How are you?", "Great")); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != 1 || second.ID != 2 {
+		t.Errorf("Expected IDs 1 and 2, got %d and %d", first.ID, second.ID)
+	}
+
+	// An ID claimed by another chat is skipped
+	dir, _ := sessionsDir()
+	os.WriteFile(filepath.Join(dir, "3.json"), nil, 0600)
+	third := &chatSession{NomiUUID: sessionBob.UUID, NomiName: "Bob", Started: time.Now()}
+	if err := third.record(testExchange("Hello", "Hi")); err != nil || third.ID != 4 {
+		t.Errorf("Expected ID 4 after the claimed ID 3, got %d (%v)", third.ID, err)
+	}
+	os.Remove(filepath.Join(dir, fmt.Sprintf("%d.json", third.ID)))
+
+	sessions, err := loadSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[1].ID != 1 {
+		t.Fatalf("Expected the most recently active session last, got %+v", sessions)
+	}
+	if len(sessions[1].Exchanges) != 2 || sessions[1].Exchanges[1].Reply.Text != "Great" || sessions[1].Exchanges[1].LatencyMs != 500 {
+		t.Errorf("Unexpected exchanges %+v", sessions[1].Exchanges)
+	}
+	if got := sessions[1].last(1); len(got) != 1 || got[0].Sent.Text != "How are you?" {
+		t.Errorf("Unexpected last exchange %+v", got)
+	}
+	if latest := latestSession(sessions, sessionBob.UUID); latest == nil || latest.ID != 2 {
+		t.Errorf("Expected session 2 to be the latest with Bob, got %+v", latest)
+	}
+
+	// Names are unique and can't be mistaken for IDs
+	if err := first.rename("planning"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.rename("planning"); err == nil {
+		t.Error("Expected a duplicate name to be refused")
+	}
+	if err := second.rename("42"); err == nil {
+		t.Error("Expected a numeric name to be refused")
+	}
+	sessions, _ = loadSessions()
+	for _, query := range []string{"1", "planning"} {
+		if session, err := findSession(sessions, query); err != nil || session.ID != 1 {
+			t.Errorf("Expected %q to find session 1, got %+v (%v)", query, session, err)
+		}
+	}
+	if _, err := findSession(sessions, "3"); err == nil {
+		t.Error("Expected an error for a missing session")
+	}
+}
+
+func TestOpenChatSession(t *testing.T) {
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	defer func() { chatResume, chatSessionName = false, "" }()
+
+	old := &chatSession{NomiUUID: sessionAlice.UUID, NomiName: "Alice", Started: time.Now()}
+	old.record(testExchange("Hi", "Hello!"))
+
+	session, err := openChatSession(sessionAlice)
+	if err != nil || session.ID != 0 {
+		t.Errorf("Expected a new session by default, got %+v (%v)", session, err)
+	}
+
+	chatResume = true
+	if session, err = openChatSession(sessionAlice); err != nil || session.ID != old.ID {
+		t.Errorf("Expected --resume to continue session %d, got %+v (%v)", old.ID, session, err)
+	}
+	if session, err = openChatSession(sessionBob); err != nil || session.ID != 0 {
+		t.Errorf("Expected --resume to start a new session with Bob, got %+v (%v)", session, err)
+	}
+
+	chatResume, chatSessionName = false, "work"
+	session, err = openChatSession(sessionAlice)
+	if err != nil || session.ID != 0 || session.Name != "work" {
+		t.Fatalf("Expected a new session named work, got %+v (%v)", session, err)
+	}
+	session.record(testExchange("Standup?", "Sure"))
+	if again, err := openChatSession(sessionAlice); err != nil || again.ID != session.ID {
+		t.Errorf("Expected --session work to continue session %d, got %+v (%v)", session.ID, again, err)
+	}
+	if _, err := openChatSession(sessionBob); err == nil || !strings.Contains(err.Error(), "is with Alice, not Bob") {
+		t.Errorf("Expected an error continuing Alice's session with Bob, got %v", err)
+	}
+}
+
+func TestSessionsCommands(t *testing.T) {
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	defer func() { sessionsShowLast, sessionsNomi = 0, "" }()
+
+	session := &chatSession{NomiUUID: sessionAlice.UUID, NomiName: "Alice", Name: "coffee", Started: time.Now()}
+	session.record(testExchange("Coffee?", "Yes please"))
+	session.record(testExchange("Latte?", "Oat milk"))
+
+	run := func(args ...string) string {
+		rootCmd := &cobra.Command{Use: "test"}
+		rootCmd.AddCommand(sessionsCmd)
+		rootCmd.SetArgs(args)
+		return ansiPattern.ReplaceAllString(captureStdout(t, func() {
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+		}), "")
+	}
+
+	if out := run("sessions", "list"); !strings.Contains(out, `#1 "coffee" with Alice, 2 exchanges`) {
+		t.Errorf("Unexpected list output %q", out)
+	}
+	if out := run("sessions", "list", "--nomi", "bob"); !strings.Contains(out, "No saved sessions.") {
+		t.Errorf("Expected no sessions with Bob, got %q", out)
+	}
+
+	// --nomi matches the sessions' Nomis by UUID prefix or partial name too
+	alina := &chatSession{NomiUUID: "b7e2c9d4-1f3a-4b5c-9d8e-7f6a5b4c3d21", NomiName: "Alina", Name: "walk", Started: time.Now()}
+	alina.record(testExchange("Walk?", "Sure"))
+	for _, query := range []string{"alic", sessionAlice.UUID[:8]} {
+		if out := run("sessions", "list", "--nomi", query); !strings.Contains(out, `"coffee" with Alice`) || strings.Contains(out, "Alina") {
+			t.Errorf("Expected only the session with Alice for %q, got %q", query, out)
+		}
+	}
+	if out := run("sessions", "list", "--nomi", "ali"); !strings.Contains(out, "matches several Nomis") {
+		t.Errorf("Expected an ambiguous Nomi error, got %q", out)
+	}
+	if out := run("sessions", "delete", "walk"); !strings.Contains(out, "Session 2 deleted.") {
+		t.Errorf("Unexpected delete output %q", out)
+	}
+
+	out := run("sessions", "show", "coffee", "--last", "1")
+	if strings.Contains(out, "Coffee?") || !strings.Contains(out, "You: Latte?") || !strings.Contains(out, "Alice: Oat milk") {
+		t.Errorf("Unexpected show output %q", out)
+	}
+
+	if out := run("sessions", "rename", "1", "tea"); !strings.Contains(out, `Session 1 renamed to "tea".`) {
+		t.Errorf("Unexpected rename output %q", out)
+	}
+	if out := run("sessions", "delete", "tea"); !strings.Contains(out, "Session 1 deleted.") {
+		t.Errorf("Unexpected delete output %q", out)
+	}
+	if sessions, _ := loadSessions(); len(sessions) != 0 {
+		t.Errorf("Expected the session to be deleted, got %+v", sessions)
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ansiReset ends any style started by a theme.
+const ansiReset = "\033[0m"
+
+// defaultTheme is used when no theme is chosen.
+const defaultTheme = "dark"
+
+// Theme holds the styles of terminal output as ANSI escape sequences. An
+// empty style prints text as is.
+type Theme struct {
+	You      string   // Your name in conversations
+	Nomi     string   // The Nomi's name in single-Nomi views
+	Title    string   // Headings
+	Info     string   // Hints and help text
+	Error    string   // Errors shown in conversations
+	Spinner  string   // The waiting spinner
+	Action   string   // *roleplay actions* in replies
+	Bold     string   // **bold** in replies
+	Emphasis string   // _emphasis_ in replies
+	Selected string   // Selected items and title bars
+	Dim      string   // Borders and secondary text
+	Nomis    []string // Colors telling Nomis apart in multi-Nomi views
+}
+
+// builtinThemes are the themes available without any configuration.
+var builtinThemes = map[string]Theme{
+	"dark": {
+		You:      "\033[32m",
+		Nomi:     "\033[34m",
+		Title:    "\033[33m",
+		Info:     "\033[34m",
+		Error:    "\033[31m",
+		Spinner:  "\033[36m",
+		Action:   "\033[3;35m",
+		Bold:     "\033[1m",
+		Emphasis: "\033[3m",
+		Selected: "\033[7m",
+		Dim:      "\033[2m",
+		Nomis:    []string{"\033[36m", "\033[35m", "\033[33m", "\033[94m", "\033[91m", "\033[96m"},
+	},
+	"light": {
+		You:      "\033[38;5;28m",
+		Nomi:     "\033[38;5;25m",
+		Title:    "\033[1;38;5;130m",
+		Info:     "\033[38;5;240m",
+		Error:    "\033[38;5;160m",
+		Spinner:  "\033[38;5;25m",
+		Action:   "\033[3;38;5;90m",
+		Bold:     "\033[1m",
+		Emphasis: "\033[3m",
+		Selected: "\033[7m",
+		Dim:      "\033[38;5;245m",
+		Nomis:    []string{"\033[38;5;25m", "\033[38;5;90m", "\033[38;5;130m", "\033[38;5;23m", "\033[38;5;124m", "\033[38;5;54m"},
+	},
+	"high-contrast": {
+		You:      "\033[1;92m",
+		Nomi:     "\033[1;96m",
+		Title:    "\033[1;93m",
+		Info:     "\033[97m",
+		Error:    "\033[1;91m",
+		Spinner:  "\033[1;96m",
+		Action:   "\033[1;3;95m",
+		Bold:     "\033[1;97m",
+		Emphasis: "\033[3;97m",
+		Selected: "\033[1;7m",
+		Dim:      "\033[97m",
+		Nomis:    []string{"\033[1;96m", "\033[1;95m", "\033[1;93m", "\033[1;94m", "\033[1;91m"},
+	},
+	"monochrome": {
+		You:      "\033[1m",
+		Nomi:     "\033[1m",
+		Title:    "\033[1;4m",
+		Error:    "\033[1m",
+		Action:   "\033[3m",
+		Bold:     "\033[1m",
+		Emphasis: "\033[3m",
+		Selected: "\033[7m",
+		Dim:      "\033[2m",
+	},
+}
+
+// theme is the active theme. setupTheme replaces it from the flags, the
+// environment and the config.
+var theme = builtinThemes[defaultTheme]
+
+// themeName is the --theme flag.
+var themeName string
+
+// paint wraps text in a style.
+func paint(style, text string) string {
+	if style == "" {
+		return text
+	}
+	return style + text + ansiReset
+}
+
+// nomiColors assigns colors to the Nomis of a multi-Nomi view, by UUID. Each
+// Nomi starts from a color derived from its UUID, so it usually keeps its
+// color across views, and moves on to the next free one so that Nomis get
+// distinct colors while the palette lasts.
+func (t Theme) nomiColors(nomis []Nomi) map[string]string {
+	colors := make(map[string]string)
+	if len(t.Nomis) == 0 {
+		for _, nomi := range nomis {
+			colors[nomi.UUID] = t.Nomi
+		}
+		return colors
+	}
+
+	uuids := make([]string, 0, len(nomis))
+	for _, nomi := range nomis {
+		uuids = append(uuids, nomi.UUID)
+	}
+	sort.Strings(uuids)
+
+	used := make(map[int]bool)
+	for _, uuid := range uuids {
+		h := fnv.New32a()
+		h.Write([]byte(uuid))
+		i := int(h.Sum32() % uint32(len(t.Nomis)))
+		for n := 0; n < len(t.Nomis) && used[i]; n++ {
+			i = (i + 1) % len(t.Nomis)
+		}
+		if len(used) < len(t.Nomis) {
+			used[i] = true
+		}
+		colors[uuid] = t.Nomis[i]
+	}
+	return colors
+}
+
+// inline returns the style of a kind of inline markup in replies.
+func (t Theme) inline(kind string) string {
+	switch kind {
+	case styleAction:
+		return t.Action
+	case styleBold:
+		return t.Bold
+	case styleEmphasis:
+		return t.Emphasis
+	}
+	return ""
+}
+
+// ThemeConfig is a user-defined theme in config.json. Each style is a list of
+// attributes (bold, dim, italic, underline, reverse) and colors: a name like
+// "red" or "bright-blue", a 256-color number like "208", or a truecolor
+// "#rrggbb". A color prefixed with "bg:" sets the background. Unset styles
+// come from the base theme.
+type ThemeConfig struct {
+	Base     string   `json:"base,omitempty"`
+	You      string   `json:"you,omitempty"`
+	Nomi     string   `json:"nomi,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Info     string   `json:"info,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Spinner  string   `json:"spinner,omitempty"`
+	Action   string   `json:"action,omitempty"`
+	Bold     string   `json:"bold,omitempty"`
+	Emphasis string   `json:"emphasis,omitempty"`
+	Selected string   `json:"selected,omitempty"`
+	Dim      string   `json:"dim,omitempty"`
+	Nomis    []string `json:"nomis,omitempty"`
+}
+
+// ansiColors are the names of the 8 standard terminal colors.
+var ansiColors = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// ansiAttributes are the text attributes a style may use.
+var ansiAttributes = map[string]string{
+	"bold":      "1",
+	"dim":       "2",
+	"italic":    "3",
+	"underline": "4",
+	"reverse":   "7",
+}
+
+// parseColor returns the SGR parameters of a color, for the foreground or
+// the background.
+func parseColor(spec string, background bool) (string, error) {
+	base, extended := 30, "38"
+	if background {
+		base, extended = 40, "48"
+	}
+
+	name := strings.TrimPrefix(spec, "bright-")
+	for i, color := range ansiColors {
+		if name == color {
+			if name != spec {
+				return strconv.Itoa(base + 60 + i), nil
+			}
+			return strconv.Itoa(base + i), nil
+		}
+	}
+
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n < 0 || n > 255 {
+			return "", fmt.Errorf("color %d is out of the 0-255 range", n)
+		}
+		return fmt.Sprintf("%s;5;%d", extended, n), nil
+	}
+
+	if len(spec) == 7 && spec[0] == '#' {
+		rgb, err := strconv.ParseUint(spec[1:], 16, 32)
+		if err == nil {
+			return fmt.Sprintf("%s;2;%d;%d;%d", extended, rgb>>16, rgb>>8&0xff, rgb&0xff), nil
+		}
+	}
+	return "", fmt.Errorf("unknown color %q", spec)
+}
+
+// parseStyle turns a style specification like "bold #ff8800" into an ANSI
+// escape sequence.
+func parseStyle(spec string) (string, error) {
+	var params []string
+	for _, token := range strings.Fields(strings.ToLower(spec)) {
+		if code, ok := ansiAttributes[token]; ok {
+			params = append(params, code)
+			continue
+		}
+		background := strings.HasPrefix(token, "bg:")
+		code, err := parseColor(strings.TrimPrefix(token, "bg:"), background)
+		if err != nil {
+			return "", err
+		}
+		params = append(params, code)
+	}
+	if len(params) == 0 {
+		return "", nil
+	}
+	return "\033[" + strings.Join(params, ";") + "m", nil
+}
+
+// build returns the theme defined by c on top of its base theme.
+func (c ThemeConfig) build(base Theme) (Theme, error) {
+	t := base
+	fields := []struct {
+		spec  string
+		style *string
+		name  string
+	}{
+		{c.You, &t.You, "you"},
+		{c.Nomi, &t.Nomi, "nomi"},
+		{c.Title, &t.Title, "title"},
+		{c.Info, &t.Info, "info"},
+		{c.Error, &t.Error, "error"},
+		{c.Spinner, &t.Spinner, "spinner"},
+		{c.Action, &t.Action, "action"},
+		{c.Bold, &t.Bold, "bold"},
+		{c.Emphasis, &t.Emphasis, "emphasis"},
+		{c.Selected, &t.Selected, "selected"},
+		{c.Dim, &t.Dim, "dim"},
+	}
+	for _, field := range fields {
+		if field.spec == "" {
+			continue
+		}
+		style, err := parseStyle(field.spec)
+		if err != nil {
+			return t, fmt.Errorf("%s: %v", field.name, err)
+		}
+		*field.style = style
+	}
+
+	if len(c.Nomis) > 0 {
+		t.Nomis = nil
+		for _, spec := range c.Nomis {
+			style, err := parseStyle(spec)
+			if err != nil {
+				return t, fmt.Errorf("nomis: %v", err)
+			}
+			t.Nomis = append(t.Nomis, style)
+		}
+	}
+	return t, nil
+}
+
+// findTheme returns a built-in or user-defined theme by name.
+func findTheme(name string, config Config) (Theme, error) {
+	if custom, ok := config.Themes[name]; ok {
+		baseName := custom.Base
+		if baseName == "" {
+			baseName = defaultTheme
+		}
+		base, ok := builtinThemes[baseName]
+		if !ok {
+			return Theme{}, fmt.Errorf("theme %s: unknown base theme %q", name, baseName)
+		}
+		t, err := custom.build(base)
+		if err != nil {
+			return Theme{}, fmt.Errorf("theme %s: %v", name, err)
+		}
+		return t, nil
+	}
+	if t, ok := builtinThemes[name]; ok {
+		return t, nil
+	}
+	return Theme{}, fmt.Errorf("unknown theme %q", name)
+}
+
+// colorEnabled reports whether output should be styled: not when NO_COLOR is
+// set (https://no-color.org) or stdout is not a terminal.
+func colorEnabled() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return stdoutIsTerminal()
+}
+
+// stdoutIsTerminal reports whether stdout is a terminal. Tests replace it.
+var stdoutIsTerminal = func() bool { return isTerminal(os.Stdout) }
+
+// setupTheme selects the theme from --theme, NOMI_THEME or the config, and
+// turns styling off when colors are disabled. A config that can't be loaded
+// or an unknown theme leaves the default theme in place; the error returned
+// is only a warning.
+func setupTheme() error {
+	config, configErr := loadConfig()
+	if configErr != nil {
+		configErr = fmt.Errorf("error loading config: %v", configErr)
+	}
+	name := themeName
+	if name == "" {
+		name = os.Getenv("NOMI_THEME")
+	}
+	if name == "" {
+		name = config.Theme
+	}
+	if name == "" {
+		name = defaultTheme
+	}
+
+	t, err := findTheme(name, config)
+	if err != nil {
+		t = builtinThemes[defaultTheme]
+		err = fmt.Errorf("%v, using the %s theme", err, defaultTheme)
+	}
+	if !colorEnabled() {
+		t = Theme{}
+	}
+	theme = t
+	return errors.Join(configErr, err)
+}
+
+// themeNames lists the built-in and user-defined theme names.
+func themeNames(config Config) []string {
+	var names []string
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	for name := range config.Themes {
+		if _, builtin := builtinThemes[name]; !builtin {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+var themeCmd = &cobra.Command{
+	Use:   "theme",
+	Short: "List and preview color themes",
+	Long: `List and preview color themes.
+
+Choose a theme with --theme, the NOMI_THEME environment variable or "theme"
+in config.json. Built-in themes are dark (the default), light, high-contrast
+and monochrome. Define your own under "themes" in config.json:
+
+  "themes": {
+    "solarized": {
+      "base": "light",
+      "you": "#859900",
+      "nomi": "bold #268bd2",
+      "action": "italic 125",
+      "nomis": ["#268bd2", "#d33682", "#2aa198"]
+    }
+  }
+
+Colors are turned off when NO_COLOR is set or output is not a terminal.`,
+}
+
+var themeListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List themes with a preview",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig()
+		if err != nil {
+			fmt.Println("Error loading config:", err)
+			return
+		}
+		for _, name := range themeNames(config) {
+			t, err := findTheme(name, config)
+			if err != nil {
+				fmt.Printf("%s: %v\n", name, err)
+				continue
+			}
+			if !colorEnabled() {
+				t = Theme{}
+			}
+			fmt.Printf("%-14s %s: hello  %s: %s %s\n", name,
+				paint(t.You, "You"), paint(t.Nomi, "Nomi"),
+				paint(t.Action, "waves"), paint(t.Title, "=== Title ==="))
+		}
+	},
+}
+
+func init() {
+	themeCmd.AddCommand(themeListCmd)
+}
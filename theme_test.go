@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStyle(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+		err  bool
+	}{
+		{spec: "", want: ""},
+		{spec: "red", want: "\033[31m"},
+		{spec: "bright-blue", want: "\033[94m"},
+		{spec: "bold italic green", want: "\033[1;3;32m"},
+		{spec: "208", want: "\033[38;5;208m"},
+		{spec: "#ff8800", want: "\033[38;2;255;136;0m"},
+		{spec: "white bg:#000080", want: "\033[37;48;2;0;0;128m"},
+		{spec: "bg:blue", want: "\033[44m"},
+		{spec: "256", err: true},
+		{spec: "#ff88", err: true},
+		{spec: "purple", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseStyle(tt.spec)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseStyle(%q): expected an error", tt.spec)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseStyle(%q) = %q, %v; expected %q", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestFindTheme(t *testing.T) {
+	config := Config{Themes: map[string]ThemeConfig{
+		"ocean":  {Base: "light", Nomi: "bold #268bd2", Nomis: []string{"33", "125"}},
+		"broken": {You: "chartreuse"},
+		"orphan": {Base: "sepia"},
+	}}
+
+	ocean, err := findTheme("ocean", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ocean.Nomi != "\033[1;38;2;38;139;210m" {
+		t.Errorf("Unexpected Nomi style %q", ocean.Nomi)
+	}
+	if ocean.You != builtinThemes["light"].You {
+		t.Errorf("Expected unset styles to come from the base theme, got %q", ocean.You)
+	}
+	if len(ocean.Nomis) != 2 || ocean.Nomis[1] != "\033[38;5;125m" {
+		t.Errorf("Unexpected Nomi palette %q", ocean.Nomis)
+	}
+
+	for _, name := range []string{"broken", "orphan", "missing"} {
+		if _, err := findTheme(name, config); err == nil {
+			t.Errorf("Expected an error for theme %s", name)
+		}
+	}
+	if _, err := findTheme("high-contrast", config); err != nil {
+		t.Errorf("Expected built-in themes to be found, got %v", err)
+	}
+}
+
+func TestNomiColor(t *testing.T) {
+	dark := builtinThemes["dark"]
+	alice := Nomi{UUID: "6a3e8f5c-2b4d-4e6f-8a1b-3c5d7e9f0a21"}
+	bob := Nomi{UUID: "9c1d2e3f-4a5b-4c6d-8e7f-0a1b2c3d4e52"}
+
+	colors := dark.nomiColors([]Nomi{alice, bob})
+	if colors[alice.UUID] == colors[bob.UUID] {
+		t.Error("Expected Alice and Bob to get different colors")
+	}
+	if again := dark.nomiColors([]Nomi{bob, alice}); again[alice.UUID] != colors[alice.UUID] || again[bob.UUID] != colors[bob.UUID] {
+		t.Error("Expected the colors not to depend on the order of the Nomis")
+	}
+	if mono := builtinThemes["monochrome"]; mono.nomiColors([]Nomi{alice})[alice.UUID] != mono.Nomi {
+		t.Error("Expected themes without a palette to use the Nomi style")
+	}
+
+	// Once the palette is used up, colors are shared
+	var many []Nomi
+	for i := 0; i < 10; i++ {
+		many = append(many, Nomi{UUID: fmt.Sprintf("nomi-%d", i)})
+	}
+	distinct := make(map[string]bool)
+	for _, color := range dark.nomiColors(many) {
+		distinct[color] = true
+	}
+	if len(distinct) != len(dark.Nomis) {
+		t.Errorf("Expected all %d palette colors to be used, got %d", len(dark.Nomis), len(distinct))
+	}
+}
+
+func TestSetupTheme(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("NOMI_CONFIG_DIR", dir)
+	saved, savedTerminal := theme, stdoutIsTerminal
+	defer func() { theme, themeName, stdoutIsTerminal = saved, "", savedTerminal }()
+
+	stdoutIsTerminal = func() bool { return false }
+	t.Setenv("NOMI_THEME", "light")
+	if err := setupTheme(); err != nil {
+		t.Fatal(err)
+	}
+	if theme.You != "" || paint(theme.Nomi, "Alice") != "Alice" {
+		t.Errorf("Expected styling to be off outside a terminal, got %+v", theme)
+	}
+
+	stdoutIsTerminal = func() bool { return true }
+	if err := setupTheme(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(theme, builtinThemes["light"]) {
+		t.Errorf("Expected the light theme in a terminal, got %+v", theme)
+	}
+
+	// An unknown theme or a broken config only warns
+	themeName = "neon"
+	err := setupTheme()
+	if err == nil || err.Error() != `unknown theme "neon", using the `+defaultTheme+` theme` {
+		t.Errorf("Expected an unknown theme warning, got %v", err)
+	}
+	if !reflect.DeepEqual(theme, builtinThemes[defaultTheme]) {
+		t.Errorf("Expected the default theme, got %+v", theme)
+	}
+
+	themeName = ""
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte("{"), 0600)
+	if err := setupTheme(); err == nil || !strings.Contains(err.Error(), "error loading config") {
+		t.Errorf("Expected a config warning, got %v", err)
+	}
+	if !reflect.DeepEqual(theme, builtinThemes["light"]) {
+		t.Errorf("Expected NOMI_THEME to still apply, got %+v", theme)
+	}
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// Escape sequences used by the full-screen UI.
+const (
+	tuiAltScreen   = "\033[?1049h"
+	tuiMainScreen  = "\033[?1049l"
+	tuiHideCursor  = "\033[?25l"
+	tuiShowCursor  = "\033[?25h"
+	tuiSidebarSize = 24
+)
+
+// Keys that are not plain characters.
+const (
+	keyRune = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEnter
+	keyTab
+	keyBackspace
+	keyEscape
+	keyInterrupt
+	keyEOF
+	keyKillLine
+)
+
+// tuiKey is a key press read from the terminal.
+type tuiKey struct {
+	Code int
+	Rune rune
+}
+
+// escapeKeys maps the escape sequences sent by common terminals to keys.
+var escapeKeys = map[string]int{
+	"\x1b[A": keyUp, "\x1bOA": keyUp,
+	"\x1b[B": keyDown, "\x1bOB": keyDown,
+	"\x1b[C": keyRight, "\x1bOC": keyRight,
+	"\x1b[D": keyLeft, "\x1bOD": keyLeft,
+	"\x1b[H": keyHome, "\x1bOH": keyHome, "\x1b[1~": keyHome,
+	"\x1b[F": keyEnd, "\x1bOF": keyEnd, "\x1b[4~": keyEnd,
+	"\x1b[5~": keyPageUp,
+	"\x1b[6~": keyPageDown,
+}
+
+// parseKeys decodes the bytes read from a raw terminal into key presses.
+// Unknown escape sequences are dropped.
+func parseKeys(data []byte) []tuiKey {
+	var keys []tuiKey
+	for len(data) > 0 {
+		if data[0] == 0x1b {
+			if len(data) == 1 || (data[1] != '[' && data[1] != 'O') {
+				keys = append(keys, tuiKey{Code: keyEscape})
+				data = data[1:]
+				continue
+			}
+			// A sequence ends with its first letter or ~ after the prefix
+			end := 2
+			for end < len(data) && !(data[end] >= 0x40 && data[end] <= 0x7e) {
+				end++
+			}
+			if end < len(data) {
+				end++
+			}
+			if code, ok := escapeKeys[string(data[:end])]; ok {
+				keys = append(keys, tuiKey{Code: code})
+			}
+			data = data[end:]
+			continue
+		}
+
+		switch data[0] {
+		case '\r', '\n':
+			keys = append(keys, tuiKey{Code: keyEnter})
+		case '\t':
+			keys = append(keys, tuiKey{Code: keyTab})
+		case 0x7f, 0x08:
+			keys = append(keys, tuiKey{Code: keyBackspace})
+		case 0x03:
+			keys = append(keys, tuiKey{Code: keyInterrupt})
+		case 0x04:
+			keys = append(keys, tuiKey{Code: keyEOF})
+		case 0x15:
+			keys = append(keys, tuiKey{Code: keyKillLine})
+		default:
+			r, size := utf8.DecodeRune(data)
+			if r >= ' ' {
+				keys = append(keys, tuiKey{Code: keyRune, Rune: r})
+			}
+			data = data[size:]
+			continue
+		}
+		data = data[1:]
+	}
+	return keys
+}
+
+// tuiLine is a message shown in a conversation.
+type tuiLine struct {
+	From  string
+	Color string
+	Text  string
+}
+
+// tui is the state of the full-screen UI. All fields are owned by the event
+// loop; background work hands its results back through events.
+type tui struct {
+	nomis    []Nomi
+	rooms    []Room
+	selected int  // Index in nomis, then rooms
+	typing   bool // Whether keys go to the input box rather than the sidebar
+	input    []rune
+	status   string
+
+	colors  map[string]string    // Nomi colors by UUID
+	history map[string][]tuiLine // Conversations by Nomi UUID
+	scroll  map[string]int       // Lines scrolled back from the bottom
+	pending map[string]bool      // Nomis we are waiting for a reply from
+
+	events   chan func()
+	mu       sync.Mutex // Guards channels
+	channels map[string]*nomiChannel
+}
+
+func newTUI(nomis []Nomi, rooms []Room) *tui {
+	return &tui{
+		nomis:    nomis,
+		rooms:    rooms,
+		colors:   theme.nomiColors(nomis),
+		history:  make(map[string][]tuiLine),
+		scroll:   make(map[string]int),
+		pending:  make(map[string]bool),
+		events:   make(chan func(), 16),
+		channels: make(map[string]*nomiChannel),
+	}
+}
+
+// selectedNomi returns the selected Nomi, or nil if a room is selected.
+func (t *tui) selectedNomi() *Nomi {
+	if t.selected < len(t.nomis) {
+		return &t.nomis[t.selected]
+	}
+	return nil
+}
+
+// selectedRoom returns the selected room, or nil if a Nomi is selected.
+func (t *tui) selectedRoom() *Room {
+	if i := t.selected - len(t.nomis); i >= 0 && i < len(t.rooms) {
+		return &t.rooms[i]
+	}
+	return nil
+}
+
+// channel returns the open channel to a Nomi, opening it on first use. Through
+// the daemon, exchanges from other terminals are added to the conversation.
+func (t *tui) channel(nomi Nomi) (*nomiChannel, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if channel, ok := t.channels[nomi.UUID]; ok {
+		return channel, nil
+	}
+	channel, err := openNomiChannel(nomi.UUID, func(exchange ChatResponse) {
+		t.events <- func() {
+			t.history[nomi.UUID] = append(t.history[nomi.UUID],
+				tuiLine{From: "You (other terminal)", Color: theme.You, Text: exchange.SentMessage.Text},
+				tuiLine{From: nomi.Name, Color: t.colors[nomi.UUID], Text: exchange.ReplyMessage.Text})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.channels[nomi.UUID] = channel
+	return channel, nil
+}
+
+// close releases the open channels.
+func (t *tui) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, channel := range t.channels {
+		channel.Close()
+	}
+}
+
+// send sends the input box to the selected Nomi in the background.
+func (t *tui) send() {
+	nomi := t.selectedNomi()
+	text := strings.TrimSpace(string(t.input))
+	if nomi == nil || text == "" {
+		return
+	}
+	if t.pending[nomi.UUID] {
+		t.status = fmt.Sprintf("Waiting for %s to reply...", nomi.Name)
+		return
+	}
+
+	t.input = nil
+	t.scroll[nomi.UUID] = 0
+	t.pending[nomi.UUID] = true
+	t.history[nomi.UUID] = append(t.history[nomi.UUID], tuiLine{From: "You", Color: theme.You, Text: text})
+
+	target := *nomi
+	go func() {
+		channel, err := t.channel(target)
+		var chatResponse ChatResponse
+		if err == nil {
+			chatResponse, err = channel.Send(text)
+		}
+		t.events <- func() {
+			t.pending[target.UUID] = false
+			line := tuiLine{From: target.Name, Color: t.colors[target.UUID], Text: chatResponse.ReplyMessage.Text}
+			if err != nil {
+				line = tuiLine{From: "Error", Color: theme.Error, Text: err.Error()}
+			}
+			t.history[target.UUID] = append(t.history[target.UUID], line)
+		}
+	}()
+}
+
+// handleKey applies a key press and reports whether the UI should quit.
+func (t *tui) handleKey(key tuiKey, chatHeight int) bool {
+	t.status = ""
+	items := len(t.nomis) + len(t.rooms)
+
+	switch key.Code {
+	case keyInterrupt:
+		return true
+	case keyTab, keyEscape:
+		t.typing = !t.typing && key.Code == keyTab && t.selectedNomi() != nil
+	case keyPageUp, keyPageDown:
+		if nomi := t.selectedNomi(); nomi != nil {
+			step := chatHeight - 1
+			if step < 1 {
+				step = 1
+			}
+			if key.Code == keyPageDown {
+				step = -step
+			}
+			t.scroll[nomi.UUID] += step
+			if t.scroll[nomi.UUID] < 0 {
+				t.scroll[nomi.UUID] = 0
+			}
+		}
+	}
+
+	if !t.typing {
+		switch {
+		case key.Code == keyEOF, key.Code == keyRune && key.Rune == 'q':
+			return true
+		case key.Code == keyUp || (key.Code == keyRune && key.Rune == 'k'):
+			if t.selected > 0 {
+				t.selected--
+			}
+		case key.Code == keyDown || (key.Code == keyRune && key.Rune == 'j'):
+			if t.selected < items-1 {
+				t.selected++
+			}
+		case key.Code == keyHome:
+			t.selected = 0
+		case key.Code == keyEnd:
+			t.selected = items - 1
+		case key.Code == keyEnter:
+			t.typing = t.selectedNomi() != nil
+		}
+		return false
+	}
+
+	switch key.Code {
+	case keyRune:
+		t.input = append(t.input, key.Rune)
+	case keyBackspace:
+		if len(t.input) > 0 {
+			t.input = t.input[:len(t.input)-1]
+		}
+	case keyKillLine:
+		t.input = nil
+	case keyEnter:
+		t.send()
+	case keyEOF:
+		if len(t.input) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fit truncates or pads s to exactly width cells.
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if displayWidth(s) <= width {
+		return s + strings.Repeat(" ", width-displayWidth(s))
+	}
+	var b strings.Builder
+	used := 0
+	for _, r := range s {
+		if used+runeWidth(r) > width-1 {
+			break
+		}
+		b.WriteRune(r)
+		used += runeWidth(r)
+	}
+	return b.String() + strings.Repeat(" ", width-1-used) + "…"
+}
+
+// tuiLayout is the size of the panes for a terminal size.
+type tuiLayout struct {
+	width, height int
+	sidebar       int // Sidebar width
+	main          int // Main pane width
+	body          int // Rows between the title and the help line
+	details       int // Rows of the detail pane
+	chat          int // Rows of the chat pane
+}
+
+func (t *tui) layout(width, height int) tuiLayout {
+	l := tuiLayout{width: width, height: height, sidebar: tuiSidebarSize}
+	if width < 3*tuiSidebarSize {
+		l.sidebar = width / 3
+	}
+	l.main = width - l.sidebar - 1
+	l.body = height - 2
+
+	var details []string
+	if nomi := t.selectedNomi(); nomi != nil {
+		details = nomiDetails(*nomi)
+	} else if room := t.selectedRoom(); room != nil {
+		details = roomDetails(*room)
+	}
+	l.details = len(details)
+	if max := l.body / 3; l.details > max {
+		l.details = max
+	}
+	// Separator, chat, separator, input
+	l.chat = l.body - l.details - 3
+	return l
+}
+
+// render draws the screen as rows of exactly width cells, and returns the
+// position of the cursor in the input box, or -1 when not typing.
+func (t *tui) render(width, height int) ([]string, int, int) {
+	l := t.layout(width, height)
+	if l.sidebar < 10 || l.chat < 1 {
+		rows := make([]string, height)
+		for i := range rows {
+			rows[i] = fit("", width)
+		}
+		rows[0] = fit("Terminal too small", width)
+		return rows, -1, -1
+	}
+
+	rows := make([]string, 0, height)
+	rows = append(rows, paint(theme.Selected, fit(" nomi-cli", width)))
+
+	sidebar := t.renderSidebar(l)
+	main, cursorCol := t.renderMain(l)
+	for i := 0; i < l.body; i++ {
+		rows = append(rows, sidebar[i]+paint(theme.Dim, "│")+main[i])
+	}
+
+	help := "↑/↓ select · Enter/Tab chat · PgUp/PgDn scroll · q quit"
+	if t.typing {
+		help = "Enter send · Esc/Tab back to list · PgUp/PgDn scroll · Ctrl-C quit"
+	}
+	if t.status != "" {
+		help = t.status
+	}
+	rows = append(rows, paint(theme.Dim, fit(" "+help, width)))
+
+	if !t.typing {
+		return rows, -1, -1
+	}
+	return rows, height - 2, l.sidebar + 1 + cursorCol
+}
+
+// renderSidebar lists the Nomis and rooms, keeping the selection in view.
+func (t *tui) renderSidebar(l tuiLayout) []string {
+	type entry struct {
+		text  string
+		style string
+	}
+	var entries []entry
+	selectedRow := 0
+	add := func(i int, name, style string) {
+		if i == t.selected {
+			selectedRow = len(entries)
+			style = theme.Selected
+		}
+		entries = append(entries, entry{text: " " + name, style: style})
+	}
+
+	entries = append(entries, entry{text: " Nomis", style: theme.Title})
+	for i, nomi := range t.nomis {
+		add(i, nomi.Name, t.colors[nomi.UUID])
+	}
+	entries = append(entries, entry{}, entry{text: " Rooms", style: theme.Title})
+	for i, room := range t.rooms {
+		name := room.Name
+		if name == "" {
+			name = "<empty>"
+		}
+		add(len(t.nomis)+i, name, "")
+	}
+
+	offset := 0
+	if selectedRow >= l.body {
+		offset = selectedRow - l.body + 1
+	}
+	rows := make([]string, l.body)
+	for i := range rows {
+		var e entry
+		if offset+i < len(entries) {
+			e = entries[offset+i]
+		}
+		rows[i] = paint(e.style, fit(e.text, l.sidebar))
+	}
+	return rows
+}
+
+// renderMain draws the detail pane, the conversation and the input box, and
+// returns the cursor column in the input box.
+func (t *tui) renderMain(l tuiLayout) ([]string, int) {
+	separator := paint(theme.Dim, strings.Repeat("─", l.main))
+	rows := make([]string, 0, l.body)
+
+	var details []string
+	nomi := t.selectedNomi()
+	if nomi != nil {
+		details = nomiDetails(*nomi)
+	} else if room := t.selectedRoom(); room != nil {
+		details = roomDetails(*room)
+	}
+	for i := 0; i < l.details; i++ {
+		rows = append(rows, fit(" "+details[i], l.main))
+	}
+	rows = append(rows, separator)
+	rows = append(rows, t.renderChat(nomi, l)...)
+	rows = append(rows, separator)
+
+	// Show the end of the input when it is wider than the box
+	prompt := " > "
+	input := t.input
+	for displayWidth(string(input)) > l.main-len(prompt)-1 {
+		input = input[1:]
+	}
+	if nomi == nil {
+		rows = append(rows, paint(theme.Dim, fit(" Select a Nomi to chat", l.main)))
+	} else {
+		rows = append(rows, fit(prompt+string(input), l.main))
+	}
+	return rows, len(prompt) + displayWidth(string(input))
+}
+
+// renderChat draws the visible part of the conversation with a Nomi.
+func (t *tui) renderChat(nomi *Nomi, l tuiLayout) []string {
+	type row struct {
+		prefix string
+		color  string
+		text   string
+	}
+	var all []row
+	if nomi == nil {
+		all = append(all, row{text: "Rooms can't be chatted with from nomi-cli yet."})
+	} else {
+		for _, line := range t.history[nomi.UUID] {
+			prefix := " " + line.From + ": "
+			for i, text := range wrapText(line.Text, l.main-displayWidth(prefix)) {
+				if i > 0 {
+					all = append(all, row{prefix: strings.Repeat(" ", displayWidth(prefix)), text: text})
+					continue
+				}
+				all = append(all, row{prefix: prefix, color: line.Color, text: text})
+			}
+		}
+		if t.pending[nomi.UUID] {
+			all = append(all, row{prefix: " ", color: theme.Dim, text: nomi.Name + " is typing..."})
+		}
+	}
+
+	// Clamp the scroll position and pick the visible rows
+	end := len(all)
+	maxScroll := end - l.chat
+	if maxScroll < 0 {
+		maxScroll = 0
+	}
+	if nomi != nil && t.scroll[nomi.UUID] > maxScroll {
+		t.scroll[nomi.UUID] = maxScroll
+	}
+	if nomi != nil {
+		end -= t.scroll[nomi.UUID]
+	}
+	start := end - l.chat
+	if start < 0 {
+		start = 0
+	}
+
+	rows := make([]string, 0, l.chat)
+	for _, r := range all[start:end] {
+		text := fit(r.prefix+r.text, l.main)
+		if r.color != "" {
+			text = paint(r.color, r.prefix) + strings.TrimPrefix(text, r.prefix)
+		}
+		rows = append(rows, text)
+	}
+	for len(rows) < l.chat {
+		rows = append(rows, fit("", l.main))
+	}
+	return rows
+}
+
+// draw renders the screen to out.
+func (t *tui) draw(out io.Writer, width, height int) {
+	rows, cursorRow, cursorCol := t.render(width, height)
+	var b strings.Builder
+	b.WriteString(tuiHideCursor + "\033[H")
+	b.WriteString(strings.Join(rows, "\r\n"))
+	if cursorRow >= 0 {
+		fmt.Fprintf(&b, "\033[%d;%dH%s", cursorRow+1, cursorCol+1, tuiShowCursor)
+	}
+	io.WriteString(out, b.String())
+}
+
+// runTUI runs the full-screen UI until the user quits.
+func runTUI(t *tui) error {
+	width, height, err := terminalSize()
+	if err != nil {
+		return err
+	}
+	restore, err := enterRawMode()
+	if err != nil {
+		return err
+	}
+	defer restore()
+	fmt.Print(tuiAltScreen)
+	defer fmt.Print(tuiShowCursor + tuiMainScreen)
+	defer t.close()
+
+	keys := make(chan []tuiKey)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- parseKeys(buf[:n])
+		}
+	}()
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+
+	for {
+		t.draw(os.Stdout, width, height)
+		select {
+		case pressed, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, key := range pressed {
+				if t.handleKey(key, t.layout(width, height).chat) {
+					return nil
+				}
+			}
+		case event := <-t.events:
+			event()
+		case <-resize:
+			if w, h, err := terminalSize(); err == nil {
+				width, height = w, h
+			}
+		}
+	}
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Browse Nomis and rooms and chat in a full-screen UI",
+	Long: `Browse Nomis and rooms and chat in a full-screen UI.
+
+The sidebar lists your Nomis and rooms, with the details of the selected one
+next to it. Select a Nomi and press Enter to chat with it; conversations are
+kept while you switch between Nomis.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+			fmt.Println("Error: tui needs an interactive terminal")
+			return
+		}
+
+		nomis, err := fetchNomis()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		t := newTUI(nomis, nil)
+		if rooms, err := fetchRooms(); err != nil {
+			t.status = fmt.Sprintf("Error loading rooms: %v", err)
+		} else {
+			t.rooms = rooms
+		}
+
+		if err := runTUI(t); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
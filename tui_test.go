@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// plainScreen renders the UI without escape sequences.
+func plainScreen(t *tui, width, height int) string {
+	rows, _, _ := t.render(width, height)
+	return ansiPattern.ReplaceAllString(strings.Join(rows, "\n"), "")
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("hé\x1b[A\x1b[6~\r\x7f\t\x1b\x03\x1b[99Zx"))
+	want := []tuiKey{
+		{Code: keyRune, Rune: 'h'},
+		{Code: keyRune, Rune: 'é'},
+		{Code: keyUp},
+		{Code: keyPageDown},
+		{Code: keyEnter},
+		{Code: keyBackspace},
+		{Code: keyTab},
+		{Code: keyEscape},
+		{Code: keyInterrupt},
+		{Code: keyRune, Rune: 'x'},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestTUINavigation(t *testing.T) {
+	server := newMockServer()
+	ui := newTUI(server.nomis, server.rooms)
+
+	screen := plainScreen(ui, 80, 24)
+	for _, want := range []string{"Nomis", "Alice", "Bob", "Rooms", "Lounge", "Nomi Details:", "- Name: Alice"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("Expected the screen to contain %q:\n%s", want, screen)
+		}
+	}
+
+	// Move down to the room: its details replace the Nomi's
+	ui.handleKey(tuiKey{Code: keyDown}, 10)
+	ui.handleKey(tuiKey{Code: keyDown}, 10)
+	screen = plainScreen(ui, 80, 24)
+	if !strings.Contains(screen, "Room: Lounge") || strings.Contains(screen, "Nomi Details:") {
+		t.Errorf("Expected the room details:\n%s", screen)
+	}
+	if ui.handleKey(tuiKey{Code: keyEnter}, 10); ui.typing {
+		t.Error("Expected Enter on a room not to focus the input box")
+	}
+
+	ui.handleKey(tuiKey{Code: keyDown}, 10)
+	if ui.selected != 2 {
+		t.Errorf("Expected the selection to stop at the last item, got %d", ui.selected)
+	}
+
+	// Typing goes to the input box, where q is a letter
+	ui.handleKey(tuiKey{Code: keyHome}, 10)
+	ui.handleKey(tuiKey{Code: keyTab}, 10)
+	for _, r := range "qa" {
+		if ui.handleKey(tuiKey{Code: keyRune, Rune: r}, 10) {
+			t.Fatal("Expected q not to quit while typing")
+		}
+	}
+	ui.handleKey(tuiKey{Code: keyBackspace}, 10)
+	if string(ui.input) != "q" {
+		t.Errorf("Expected input %q, got %q", "q", string(ui.input))
+	}
+	ui.handleKey(tuiKey{Code: keyEscape}, 10)
+	if ui.typing || !ui.handleKey(tuiKey{Code: keyRune, Rune: 'q'}, 10) {
+		t.Error("Expected Escape to return to the sidebar, where q quits")
+	}
+}
+
+func TestTUIChat(t *testing.T) {
+	t.Setenv("NOMI_DAEMON_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	server := newMockServer()
+	api := httptest.NewServer(server.handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	ui := newTUI(server.nomis, server.rooms)
+	ui.handleKey(tuiKey{Code: keyEnter}, 10)
+	for _, key := range parseKeys([]byte("Hello there\r")) {
+		ui.handleKey(key, 10)
+	}
+	if screen := plainScreen(ui, 80, 24); !strings.Contains(screen, "Alice is typing...") {
+		t.Errorf("Expected a typing indicator:\n%s", screen)
+	}
+
+	select {
+	case event := <-ui.events:
+		event()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the reply")
+	}
+	defer ui.close()
+
+	screen := plainScreen(ui, 80, 24)
+	for _, want := range []string{"You: Hello there", "Alice: You said: Hello there"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("Expected the screen to contain %q:\n%s", want, screen)
+		}
+	}
+
+	// Conversations are kept per Nomi
+	ui.handleKey(tuiKey{Code: keyTab}, 10)
+	ui.handleKey(tuiKey{Code: keyDown}, 10)
+	if screen := plainScreen(ui, 80, 24); strings.Contains(screen, "Hello there") {
+		t.Errorf("Expected Bob's conversation to be empty:\n%s", screen)
+	}
+}
+
+func TestTUIRenderSize(t *testing.T) {
+	server := newMockServer()
+	ui := newTUI(server.nomis, server.rooms)
+	rows, _, _ := ui.render(60, 20)
+	if len(rows) != 20 {
+		t.Fatalf("Expected 20 rows, got %d", len(rows))
+	}
+	for i, row := range rows {
+		if n := displayWidth(ansiPattern.ReplaceAllString(row, "")); n != 60 {
+			t.Errorf("Expected row %d to be 60 cells wide, got %d: %q", i, n, row)
+		}
+	}
+	if screen := plainScreen(ui, 20, 5); !strings.Contains(screen, "Terminal too small") {
+		t.Errorf("Expected a warning for tiny terminals, got:\n%s", screen)
+	}
+}
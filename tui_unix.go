@@ -0,0 +1,65 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// stty runs stty on the terminal attached to stdin.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// enterRawMode switches the terminal to raw mode, returning a function that
+// restores the previous settings.
+func enterRawMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("error reading terminal settings: %v", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("error switching terminal to raw mode: %v", err)
+	}
+	return func() { stty(saved) }, nil
+}
+
+// enterKeyMode switches the terminal to deliver key presses as they are
+// typed, without echo or signals, returning a function that restores the
+// previous settings. Unlike raw mode, output is processed as usual.
+func enterKeyMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("error reading terminal settings: %v", err)
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "min", "1"); err != nil {
+		return nil, fmt.Errorf("error switching terminal to key mode: %v", err)
+	}
+	return func() { stty(saved) }, nil
+}
+
+// terminalSize returns the terminal's width and height in cells.
+func terminalSize() (int, int, error) {
+	out, err := stty("size")
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading terminal size: %v", err)
+	}
+	var height, width int
+	if _, err := fmt.Sscanf(out, "%d %d", &height, &width); err != nil {
+		return 0, 0, fmt.Errorf("error reading terminal size: %v", err)
+	}
+	return width, height, nil
+}
+
+// notifyResize sends on ch whenever the terminal is resized.
+func notifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// enterRawMode is not supported on Windows, where stty is not available.
+func enterRawMode() (func(), error) {
+	return nil, fmt.Errorf("the full-screen UI is not supported on Windows yet")
+}
+
+// enterKeyMode is not supported on Windows.
+func enterKeyMode() (func(), error) {
+	return nil, fmt.Errorf("reading key presses is not supported on Windows yet")
+}
+
+// terminalSize is not supported on Windows.
+func terminalSize() (int, int, error) {
+	return 0, 0, fmt.Errorf("the full-screen UI is not supported on Windows yet")
+}
+
+// notifyResize does nothing on Windows.
+func notifyResize(ch chan<- os.Signal) {}
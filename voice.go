@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// voiceTimeout bounds how long speech-to-text may take once recording stops.
+const voiceTimeout = 2 * time.Minute
+
+// VoiceConfig holds the local speech commands used by chat --voice. The
+// speech-to-text command records while its stdin is open and prints the
+// transcript when it is closed; the text-to-speech command speaks the text
+// read on stdin.
+type VoiceConfig struct {
+	STT string `json:"stt,omitempty"`
+	TTS string `json:"tts,omitempty"`
+}
+
+// voice runs the speech commands of a chat with a Nomi. A command is ""
+// when it isn't configured or available, and chat falls back to text.
+type voice struct {
+	nomi Nomi
+	stt  string
+	tts  string
+}
+
+// checkCommand reports why line can't be run, if its program is not found.
+// Only a plain program name or path is looked up: a line starting with shell
+// syntax, like a variable assignment or quotes, is left to fail when run.
+func checkCommand(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return fmt.Errorf("no command configured")
+	}
+	if strings.ContainsAny(fields[0], "=$\"'`~(){};|&<>*?[]") {
+		return nil
+	}
+	if _, err := exec.LookPath(fields[0]); err != nil {
+		return fmt.Errorf("%s not found", fields[0])
+	}
+	return nil
+}
+
+// newVoice sets up the speech commands, explaining on w which ones are
+// unavailable.
+func newVoice(nomi Nomi, config VoiceConfig, w io.Writer) *voice {
+	v := &voice{nomi: nomi}
+	if err := checkCommand(config.STT); err != nil {
+		fmt.Fprintf(w, "Voice input unavailable (%v), type your messages instead.\n", err)
+	} else {
+		v.stt = config.STT
+	}
+	if err := checkCommand(config.TTS); err != nil {
+		fmt.Fprintf(w, "Voice output unavailable (%v), replies are shown as text only.\n", err)
+	} else {
+		v.tts = config.TTS
+	}
+	return v
+}
+
+// command returns a shell command for line, describing the Nomi to it by
+// NOMI_UUID and NOMI_NAME like hooks.
+func (v *voice) command(ctx context.Context, line string) *exec.Cmd {
+	cmd := shellCommand(ctx, line)
+	cmd.Env = append(os.Environ(), "NOMI_UUID="+v.nomi.UUID, "NOMI_NAME="+v.nomi.Name)
+	cmd.WaitDelay = time.Second
+	return cmd
+}
+
+// recording is a speech-to-text command capturing speech.
+type recording struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	stdin  io.WriteCloser
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+// record starts the speech-to-text command.
+func (v *voice) record() (*recording, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &recording{cmd: v.command(ctx, v.stt), cancel: cancel}
+	r.cmd.Stdout = &r.stdout
+	r.cmd.Stderr = &r.stderr
+	stdin, err := r.cmd.StdinPipe()
+	if err == nil {
+		err = r.cmd.Start()
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r.stdin = stdin
+	return r, nil
+}
+
+// stop ends the recording and returns the transcript.
+func (r *recording) stop() (string, error) {
+	defer r.cancel()
+	r.stdin.Close()
+	timer := time.AfterFunc(voiceTimeout, r.cancel)
+	err := r.cmd.Wait()
+	if !timer.Stop() {
+		return "", fmt.Errorf("speech-to-text took longer than %s", voiceTimeout)
+	}
+	if err != nil {
+		if reason := strings.TrimSpace(r.stderr.String()); reason != "" {
+			err = fmt.Errorf("%v: %s", err, reason)
+		}
+		return "", err
+	}
+	return strings.Join(strings.Fields(r.stdout.String()), " "), nil
+}
+
+// speak says text with the text-to-speech command.
+func (v *voice) speak(text string) error {
+	cmd := v.command(context.Background(), v.tts)
+	cmd.Stdin = strings.NewReader(speechText(text))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if reason := strings.TrimSpace(stderr.String()); reason != "" {
+			err = fmt.Errorf("%v: %s", err, reason)
+		}
+		return err
+	}
+	return nil
+}
+
+// speechText returns a reply without its markdown markers and list bullets,
+// to be read out.
+func speechText(text string) string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		_, content := listItem(paragraph)
+		if line := formatLine(parseInline(content), false); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestVoiceCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("speech commands are sh commands in this test")
+	}
+	spoken := filepath.Join(t.TempDir(), "spoken.txt")
+
+	var warnings strings.Builder
+	v := newVoice(Nomi{UUID: "a", Name: "Alice"}, VoiceConfig{
+		STT: `cat > /dev/null; echo "  hello   there "`,
+		TTS: `cat > ` + spoken + `; echo "$NOMI_NAME" >> ` + spoken,
+	}, &warnings)
+	if warnings.Len() != 0 || v.stt == "" || v.tts == "" {
+		t.Fatalf("Expected both commands to be available, got warnings %q", warnings.String())
+	}
+
+	recording, err := v.record()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if transcript, err := recording.stop(); err != nil || transcript != "hello there" {
+		t.Errorf("Expected transcript %q, got %q (%v)", "hello there", transcript, err)
+	}
+
+	if err := v.speak("*waves* Hi **there**!\n- one\n- two"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	data, _ := os.ReadFile(spoken)
+	if want := "waves Hi there!\none\ntwo\nAlice\n"; string(data) != want {
+		t.Errorf("Expected spoken text %q, got %q", want, string(data))
+	}
+
+	v.stt = "echo oops >&2; exit 3"
+	recording, err = v.record()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := recording.stop(); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("Expected the command's error, got %v", err)
+	}
+}
+
+func TestVoiceFallback(t *testing.T) {
+	var warnings strings.Builder
+	v := newVoice(Nomi{}, VoiceConfig{TTS: "no-such-speech-tool --voice en"}, &warnings)
+	if v.stt != "" || v.tts != "" {
+		t.Errorf("Expected no voice commands, got %+v", v)
+	}
+	for _, want := range []string{"Voice input unavailable (no command configured)", "Voice output unavailable (no-such-speech-tool not found)"} {
+		if !strings.Contains(warnings.String(), want) {
+			t.Errorf("Expected warning %q, got %q", want, warnings.String())
+		}
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		err  string
+	}{
+		{"", "no command configured"},
+		{"no-such-speech-tool --voice en", "no-such-speech-tool not found"},
+		{"LANG=en no-such-speech-tool", ""},
+		{`"$HOME/bin/speak" --fast`, ""},
+	}
+	for _, test := range tests {
+		err := checkCommand(test.line)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("checkCommand(%q) = %v, want %q", test.line, err, test.err)
+		}
+	}
+}
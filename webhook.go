@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// WebhookConfig is an endpoint notified of every chat reply.
+type WebhookConfig struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"` // HMAC-SHA256 signing key
+}
+
+// webhookPayload is the JSON body posted to webhooks.
+type webhookPayload struct {
+	Event        string      `json:"event"`
+	ID           string      `json:"id"`
+	Timestamp    string      `json:"timestamp"`
+	Nomi         webhookNomi `json:"nomi"`
+	SentMessage  Message     `json:"sentMessage"`
+	ReplyMessage Message     `json:"replyMessage"`
+	LatencyMs    int64       `json:"latencyMs"`
+}
+
+type webhookNomi struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+// queuedDelivery is a delivery that failed and waits on disk for a retry.
+type queuedDelivery struct {
+	URL         string `json:"url"`
+	Body        string `json:"body"`
+	Attempts    int    `json:"attempts"`
+	LastError   string `json:"lastError"`
+	NextAttempt string `json:"nextAttempt"`
+}
+
+type webhookQueueFile struct {
+	Deliveries []queuedDelivery `json:"deliveries"`
+}
+
+const (
+	webhookTimeout     = 10 * time.Second
+	webhookMaxAttempts = 12
+	webhookMaxBackoff  = time.Hour
+)
+
+// webhookRetryTime bounds how long a reply spends retrying queued deliveries,
+// so that a dead endpoint with a backlog doesn't hold up every command's exit.
+const webhookRetryTime = 10 * time.Second
+
+// webhookDeliveries tracks in-flight deliveries so the process can wait for
+// them before exiting.
+var webhookDeliveries sync.WaitGroup
+
+// webhookQueueMu serializes access to the queue file within the process;
+// lockFile does across processes.
+var webhookQueueMu sync.Mutex
+
+// webhookFlushMu lets one flush at a time retry the queue, so a delivery
+// isn't sent twice by concurrent replies.
+var webhookFlushMu sync.Mutex
+
+// signWebhook returns the X-Nomi-Signature header value for body.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyWebhooks posts a reply to every configured webhook in the background.
+// Failed deliveries are queued on disk, and the queued deliveries that are due
+// are retried after the new ones, for at most webhookRetryTime. Deliveries
+// may thus arrive out of order; receivers can sort them by timestamp.
+func notifyWebhooks(nomi Nomi, chatResponse ChatResponse, latency time.Duration) {
+	config, err := loadConfig()
+	if err != nil || len(config.Webhooks) == 0 {
+		return
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	body, err := json.Marshal(webhookPayload{
+		Event:        "chat.reply",
+		ID:           hex.EncodeToString(id),
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		Nomi:         webhookNomi{UUID: nomi.UUID, Name: nomi.Name},
+		SentMessage:  chatResponse.SentMessage,
+		ReplyMessage: chatResponse.ReplyMessage,
+		LatencyMs:    latency.Milliseconds(),
+	})
+	if err != nil {
+		return
+	}
+
+	webhookDeliveries.Add(1)
+	go func() {
+		defer webhookDeliveries.Done()
+
+		for _, webhook := range config.Webhooks {
+			if err := deliverWebhook(context.Background(), webhook, body); err != nil {
+				enqueueDelivery(queuedDelivery{URL: webhook.URL, Body: string(body)}, err)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), webhookRetryTime)
+		defer cancel()
+		flushWebhookQueue(ctx, config, false)
+	}()
+}
+
+// deliverWebhook posts body to a webhook, succeeding on any 2xx status.
+func deliverWebhook(ctx context.Context, webhook WebhookConfig, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nomi-cli/"+Version)
+	req.Header.Set("X-Nomi-Event", "chat.reply")
+	if webhook.Secret != "" {
+		req.Header.Set("X-Nomi-Signature", signWebhook(webhook.Secret, body))
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func webhookQueuePath() (string, error) {
+	return configPath("webhook-queue.json")
+}
+
+// enqueueDelivery records a failed delivery with exponential backoff.
+func enqueueDelivery(delivery queuedDelivery, cause error) {
+	if !scheduleRetry(&delivery, cause) {
+		return
+	}
+	path, err := webhookQueuePath()
+	if err != nil {
+		return
+	}
+	updateWebhookQueue(path, func(queue *webhookQueueFile) bool {
+		queue.Deliveries = append(queue.Deliveries, delivery)
+		return true
+	})
+}
+
+// updateWebhookQueue applies update to the queue file, which is saved when
+// update returns true. The file stays locked meanwhile, so concurrent
+// processes don't lose each other's changes.
+func updateWebhookQueue(path string, update func(queue *webhookQueueFile) bool) {
+	webhookQueueMu.Lock()
+	defer webhookQueueMu.Unlock()
+	unlock, err := lockFile(path)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	var queue webhookQueueFile
+	loadJSONFile(path, &queue)
+	if update(&queue) {
+		saveJSONFile(path, queue)
+	}
+}
+
+// scheduleRetry records a failed attempt and sets when to try again. It
+// returns false when the delivery has failed too often and is dropped.
+func scheduleRetry(delivery *queuedDelivery, cause error) bool {
+	delivery.Attempts++
+	delivery.LastError = cause.Error()
+	if delivery.Attempts >= webhookMaxAttempts {
+		fmt.Fprintf(os.Stderr, "Dropping webhook delivery to %s after %d attempts: %v\n", delivery.URL, delivery.Attempts, cause)
+		return false
+	}
+	backoff := time.Duration(1<<uint(delivery.Attempts-1)) * 30 * time.Second
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	delivery.NextAttempt = time.Now().Add(backoff).UTC().Format(time.RFC3339)
+	return true
+}
+
+// flushWebhookQueue retries queued deliveries that are due, or all of them
+// when force is set. Deliveries to webhooks no longer configured are dropped.
+// Each delivery stays in the queue file until it is sent or dropped, so none
+// is lost if the process stops midway. Once ctx is done, the remaining
+// deliveries are left for later. It returns the number of deliveries sent and
+// still queued.
+func flushWebhookQueue(ctx context.Context, config Config, force bool) (sent, pending int) {
+	webhookFlushMu.Lock()
+	defer webhookFlushMu.Unlock()
+
+	path, err := webhookQueuePath()
+	if err != nil {
+		return 0, 0
+	}
+	var queue webhookQueueFile
+	webhookQueueMu.Lock()
+	loadJSONFile(path, &queue)
+	webhookQueueMu.Unlock()
+
+	secrets := make(map[string]WebhookConfig)
+	for _, webhook := range config.Webhooks {
+		secrets[webhook.URL] = webhook
+	}
+
+	now := time.Now()
+	for _, delivery := range queue.Deliveries {
+		webhook, ok := secrets[delivery.URL]
+		if !ok {
+			replaceQueued(path, delivery, nil)
+			continue
+		}
+		due, _ := time.Parse(time.RFC3339, delivery.NextAttempt)
+		if ctx.Err() != nil || !force && now.Before(due) {
+			pending++
+			continue
+		}
+		if err := deliverWebhook(ctx, webhook, []byte(delivery.Body)); err != nil {
+			if ctx.Err() != nil {
+				pending++
+				continue
+			}
+			retry := delivery
+			if scheduleRetry(&retry, err) {
+				replaceQueued(path, delivery, &retry)
+				pending++
+			} else {
+				replaceQueued(path, delivery, nil)
+			}
+			continue
+		}
+		replaceQueued(path, delivery, nil)
+		sent++
+	}
+	return sent, pending
+}
+
+// replaceQueued replaces a delivery in the queue file with replacement, or
+// removes it when replacement is nil.
+func replaceQueued(path string, delivery queuedDelivery, replacement *queuedDelivery) {
+	updateWebhookQueue(path, func(queue *webhookQueueFile) bool {
+		for i, queued := range queue.Deliveries {
+			if queued != delivery {
+				continue
+			}
+			if replacement != nil {
+				queue.Deliveries[i] = *replacement
+			} else {
+				queue.Deliveries = append(queue.Deliveries[:i], queue.Deliveries[i+1:]...)
+			}
+			return true
+		}
+		return false
+	})
+}
+
+var webhookSecret string
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Manage webhooks notified of every chat reply",
+	Long: `Manage webhooks notified of every chat reply.
+
+Each reply received by any command (chat, send, the daemon and the servers)
+is posted as JSON to every webhook, with the sent message, the reply, the
+Nomi's UUID and name and the latency. With a secret, the body is signed with
+HMAC-SHA256 in the X-Nomi-Signature header ("sha256=<hex>"). Failed
+deliveries are queued on disk and retried with backoff.`,
+}
+
+var webhookAddCmd = &cobra.Command{
+	Use:         "add [url]",
+	Short:       "Add a webhook",
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig()
+		if err != nil {
+			fmt.Println("Error loading config:", err)
+			return
+		}
+		for _, webhook := range config.Webhooks {
+			if webhook.URL == args[0] {
+				fmt.Printf("Error: webhook %s already exists\n", args[0])
+				return
+			}
+		}
+		config.Webhooks = append(config.Webhooks, WebhookConfig{URL: args[0], Secret: webhookSecret})
+		if err := saveConfig(config); err != nil {
+			fmt.Println("Error saving config:", err)
+			return
+		}
+		fmt.Printf("Webhook %s added.\n", args[0])
+	},
+}
+
+var webhookListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List webhooks and queued deliveries",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig()
+		if err != nil {
+			fmt.Println("Error loading config:", err)
+			return
+		}
+		if len(config.Webhooks) == 0 {
+			fmt.Println("No webhooks configured.")
+			return
+		}
+
+		queued := make(map[string]int)
+		if path, err := webhookQueuePath(); err == nil {
+			var queue webhookQueueFile
+			loadJSONFile(path, &queue)
+			for _, delivery := range queue.Deliveries {
+				queued[delivery.URL]++
+			}
+		}
+
+		for _, webhook := range config.Webhooks {
+			signed := "unsigned"
+			if webhook.Secret != "" {
+				signed = "signed"
+			}
+			fmt.Printf("%s (%s, %d queued)\n", webhook.URL, signed, queued[webhook.URL])
+		}
+	},
+}
+
+var webhookRemoveCmd = &cobra.Command{
+	Use:         "remove [url]",
+	Short:       "Remove a webhook",
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig()
+		if err != nil {
+			fmt.Println("Error loading config:", err)
+			return
+		}
+		kept := config.Webhooks[:0]
+		for _, webhook := range config.Webhooks {
+			if webhook.URL != args[0] {
+				kept = append(kept, webhook)
+			}
+		}
+		if len(kept) == len(config.Webhooks) {
+			fmt.Printf("Error: no webhook %s\n", args[0])
+			return
+		}
+		config.Webhooks = kept
+		if err := saveConfig(config); err != nil {
+			fmt.Println("Error saving config:", err)
+			return
+		}
+		fmt.Printf("Webhook %s removed.\n", args[0])
+	},
+}
+
+var webhookFlushCmd = &cobra.Command{
+	Use:         "flush",
+	Short:       "Retry all queued deliveries now",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{noAPIKeyAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig()
+		if err != nil {
+			fmt.Println("Error loading config:", err)
+			return
+		}
+		sent, pending := flushWebhookQueue(context.Background(), config, true)
+		fmt.Printf("Delivered %d, %d still queued.\n", sent, pending)
+	},
+}
+
+func init() {
+	webhookAddCmd.Flags().StringVar(&webhookSecret, "secret", "", "Secret used to sign deliveries with HMAC-SHA256")
+
+	webhookCmd.AddCommand(webhookAddCmd)
+	webhookCmd.AddCommand(webhookListCmd)
+	webhookCmd.AddCommand(webhookRemoveCmd)
+	webhookCmd.AddCommand(webhookFlushCmd)
+}
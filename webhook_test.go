@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignedDelivery(t *testing.T) {
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+
+	payloads := make(chan webhookPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Nomi-Signature") != signWebhook("s3cret", body) {
+			t.Errorf("Invalid signature %q", r.Header.Get("X-Nomi-Signature"))
+		}
+		var payload webhookPayload
+		json.Unmarshal(body, &payload)
+		payloads <- payload
+	}))
+	defer receiver.Close()
+	saveConfig(Config{Webhooks: []WebhookConfig{{URL: receiver.URL, Secret: "s3cret"}}})
+
+	api := httptest.NewServer(newMockServer().handler())
+	defer api.Close()
+	baseURL = api.URL
+	apiKey = "test-api-key"
+
+	nomi, _ := resolveNomi("Alice")
+	if _, err := sendChat(nomi, "Hello"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	webhookDeliveries.Wait()
+
+	select {
+	case payload := <-payloads:
+		if payload.Event != "chat.reply" || payload.Nomi.Name != "Alice" || payload.Nomi.UUID != nomi.UUID {
+			t.Errorf("Unexpected payload: %+v", payload)
+		}
+		if payload.SentMessage.Text != "Hello" || payload.ReplyMessage.Text != "You said: Hello" {
+			t.Errorf("Unexpected messages: %+v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a webhook delivery")
+	}
+}
+
+func TestWebhookQueueRetries(t *testing.T) {
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+
+	var up atomic.Bool
+	var received, queuedWhileSending atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received.Add(1)
+		var queue webhookQueueFile
+		path, _ := webhookQueuePath()
+		loadJSONFile(path, &queue)
+		queuedWhileSending.Store(int32(len(queue.Deliveries)))
+	}))
+	defer receiver.Close()
+	config := Config{Webhooks: []WebhookConfig{{URL: receiver.URL}}}
+	saveConfig(config)
+
+	notifyWebhooks(Nomi{UUID: "uuid-1", Name: "Alice"}, ChatResponse{}, time.Second)
+	webhookDeliveries.Wait()
+
+	// The failed delivery is queued and not yet due
+	if sent, pending := flushWebhookQueue(context.Background(), config, false); sent != 0 || pending != 1 {
+		t.Errorf("Expected 1 pending delivery, got sent=%d pending=%d", sent, pending)
+	}
+
+	up.Store(true)
+	if sent, pending := flushWebhookQueue(context.Background(), config, true); sent != 1 || pending != 0 {
+		t.Errorf("Expected the queued delivery to be sent, got sent=%d pending=%d", sent, pending)
+	}
+	if received.Load() != 1 {
+		t.Errorf("Expected 1 delivery, got %d", received.Load())
+	}
+	// The delivery stays queued until it is sent, then leaves the queue
+	if queuedWhileSending.Load() != 1 {
+		t.Errorf("Expected the delivery to stay queued while it was sent, got %d queued", queuedWhileSending.Load())
+	}
+	if sent, pending := flushWebhookQueue(context.Background(), config, true); sent != 0 || pending != 0 {
+		t.Errorf("Expected an empty queue, got sent=%d pending=%d", sent, pending)
+	}
+}
+
+func TestWebhookQueueFlushStopsWithContext(t *testing.T) {
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+
+	var received atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer receiver.Close()
+	config := Config{Webhooks: []WebhookConfig{{URL: receiver.URL}}}
+	enqueueDelivery(queuedDelivery{URL: receiver.URL, Body: "{}"}, io.EOF)
+
+	// A flush out of time leaves the queue as it was
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if sent, pending := flushWebhookQueue(ctx, config, true); sent != 0 || pending != 1 || received.Load() != 0 {
+		t.Errorf("Expected nothing sent, got sent=%d pending=%d received=%d", sent, pending, received.Load())
+	}
+	var queue webhookQueueFile
+	path, _ := webhookQueuePath()
+	loadJSONFile(path, &queue)
+	if len(queue.Deliveries) != 1 || queue.Deliveries[0].Attempts != 1 {
+		t.Errorf("Expected the delivery queued after 1 attempt, got %+v", queue.Deliveries)
+	}
+}
+
+func TestWebhookQueueLock(t *testing.T) {
+	t.Setenv("NOMI_CONFIG_DIR", t.TempDir())
+	path, _ := webhookQueuePath()
+
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	locked := make(chan func())
+	go func() {
+		unlock, _ := lockFile(path)
+		locked <- unlock
+	}()
+	select {
+	case <-locked:
+		t.Fatal("Expected the lock to be held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case unlock := <-locked:
+		unlock()
+	case <-time.After(time.Second):
+		t.Fatal("Expected the lock to be taken once released")
+	}
+
+	// A lock left behind by a stopped process is broken
+	os.WriteFile(path+".lock", nil, 0600)
+	old := time.Now().Add(-2 * fileLockStale)
+	os.Chtimes(path+".lock", old, old)
+	unlock, err = lockFile(path)
+	if err != nil {
+		t.Fatalf("Expected the stale lock to be broken, got %v", err)
+	}
+	unlock()
+}